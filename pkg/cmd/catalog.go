@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+const (
+	CatalogInfoFile = "catalog-info.yaml"
+	IndexFile       = "index.yaml"
+)
+
+// indexEntry records where a generated template came from.
+type indexEntry struct {
+	File       string `yaml:"file"`
+	Source     string `yaml:"source,omitempty"`
+	Definition string `yaml:"definition,omitempty"`
+}
+
+// writeCatalogInfo writes a Backstage Location entity listing the given templates so the output directory can be
+// registered in one step. Targets are relative to the location file.
+func writeCatalogInfo(w *outputWriter, outputRoot, name string, templates []string) error {
+	targets := make([]string, 0, len(templates))
+	for _, t := range templates {
+		rel, err := filepath.Rel(outputRoot, t)
+		if err != nil {
+			return err
+		}
+		targets = append(targets, fmt.Sprintf("./%s", filepath.ToSlash(rel)))
+	}
+	if name == "" {
+		name = entityName(filepath.Base(outputRoot))
+	}
+	location := map[string]any{
+		"apiVersion": "backstage.io/v1alpha1",
+		"kind":       "Location",
+		"metadata": map[string]any{
+			"name":        name,
+			"description": "Backstage templates generated by cnoe",
+		},
+		"spec": map[string]any{
+			"targets": targets,
+		},
+	}
+	path := filepath.Join(outputRoot, CatalogInfoFile)
+	log.Printf("writing location for %d templates to %s", len(targets), path)
+	return w.write(location, path)
+}
+
+// writeIndex writes the list of generated files together with the definitions they were generated from.
+func writeIndex(w *outputWriter, inputRoot, outputRoot string, outputs []EntityOutput) error {
+	// sources of a single input file are relative to its directory
+	if info, err := os.Stat(inputRoot); err == nil && !info.IsDir() {
+		inputRoot = filepath.Dir(inputRoot)
+	}
+	entries := make([]indexEntry, 0, len(outputs))
+	for _, o := range outputs {
+		file, err := filepath.Rel(outputRoot, o.FileName)
+		if err != nil {
+			return err
+		}
+		e := indexEntry{
+			File:       filepath.ToSlash(file),
+			Definition: o.Definition,
+		}
+		if o.Source != "" {
+			source, err := filepath.Rel(inputRoot, o.Source)
+			if err != nil {
+				source = o.Source
+			}
+			e.Source = filepath.ToSlash(source)
+		}
+		entries = append(entries, e)
+	}
+	return w.write(map[string]any{"templates": entries}, filepath.Join(outputRoot, IndexFile))
+}
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cnoe-io/cnoe-cli/pkg/lib"
+)
+
+// clusterPrefix marks definitions read from a cluster instead of a file.
+const clusterPrefix = "cluster:"
+
+// defaultKubeConfig returns the kubeconfig in KUBECONFIG, or the one in the home directory.
+func defaultKubeConfig() (string, error) {
+	if config := os.Getenv("KUBECONFIG"); config != "" {
+		return config, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".kube", "config"), nil
+}
+
+// clusterDefinitions reads the selected definitions from the cluster. They are kept in memory and returned as
+// cluster:<resource>/<name>.
+func (c *CRDModule) clusterDefinitions(ctx context.Context) ([]string, error) {
+	defs, err := c.Client.Definitions(ctx, c.ClusterSelector)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read definitions from the cluster: %w", err)
+	}
+	log.Printf("read %d definitions from the cluster", len(defs))
+
+	c.cluster = make(map[string][]byte, len(defs))
+	out := make([]string, 0, len(defs))
+	for i := range defs {
+		resource := lib.CRDResource.Resource
+		if defs[i].GetKind() == KindXRD {
+			resource = lib.XRDResource.Resource
+		}
+		data, err := defs[i].MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		def := fmt.Sprintf("%s%s/%s", clusterPrefix, resource, defs[i].GetName())
+		c.cluster[def] = data
+		out = append(out, def)
+	}
+	return out, nil
+}
+
+// readDefinition returns the content of a definition file or of a definition read from the cluster.
+func (c *CRDModule) readDefinition(def string) ([]byte, error) {
+	if strings.HasPrefix(def, clusterPrefix) {
+		data, ok := c.cluster[def]
+		if !ok {
+			return nil, fmt.Errorf("%s was not read from the cluster", def)
+		}
+		return data, nil
+	}
+	return os.ReadFile(def)
+}
@@ -1,9 +1,14 @@
 package cmd_test
 
 import (
+	"os"
+	"path/filepath"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
+	"github.com/cnoe-io/cnoe-cli/pkg/cmd"
+
 	"testing"
 )
 
@@ -11,3 +16,19 @@ func TestCmds(t *testing.T) {
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "Commands Suite")
 }
+
+// readOutputDir lists the generated files of an output directory, leaving out the state kept next to them.
+func readOutputDir(dir string) ([]os.DirEntry, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	stateDir := filepath.Dir(cmd.ManifestFile)
+	out := make([]os.DirEntry, 0, len(files))
+	for _, f := range files {
+		if f.Name() != stateDir {
+			out = append(out, f)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/cnoe-io/cnoe-cli/pkg/models"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	KindComposition = "Composition"
+
+	// CompositionRef lets users pick a composition by name, CompositionSelector by its labels.
+	CompositionRef      = "ref"
+	CompositionSelector = "selector"
+
+	// CompositionDescriptionAnnotation describes a composition in the generated form.
+	CompositionDescriptionAnnotation = "cnoe.io/description"
+)
+
+// compositionIndex holds the compositions found in the input by the group and kind of the composite they implement.
+type compositionIndex map[string][]models.Composition
+
+func compositionKey(group, kind string) string {
+	return fmt.Sprintf("%s/%s", group, kind)
+}
+
+// readCompositions returns the compositions in the given definitions. Definitions that cannot be read are skipped,
+// they are reported when converting definitions.
+func readCompositions(defs []string, read func(string) ([]byte, error)) compositionIndex {
+	out := make(compositionIndex)
+	for _, f := range defs {
+		data, err := read(f)
+		if err != nil {
+			continue
+		}
+		raws, err := readDocuments(data)
+		if err != nil {
+			continue
+		}
+		for _, raw := range raws {
+			var c models.Composition
+			if err := yaml.Unmarshal(raw, &c); err != nil || c.Kind != KindComposition {
+				continue
+			}
+			group := strings.Split(c.Spec.CompositeTypeRef.APIVersion, "/")[0]
+			key := compositionKey(group, c.Spec.CompositeTypeRef.Kind)
+			out[key] = append(out[key], c)
+		}
+	}
+	for k := range out {
+		sort.Slice(out[k], func(i, j int) bool {
+			return out[k][i].Metadata.Name < out[k][j].Metadata.Name
+		})
+	}
+	return out
+}
+
+// addCompositions adds a field selecting one of the compositions implementing the resource to its configuration.
+func (c *CRDModule) addCompositions(r crdResource) {
+	if c.Compositions == "" || !isXRD(r.doc) {
+		return
+	}
+	compositions := c.compositions[compositionKey(r.doc.Spec.Group, r.doc.Spec.Names.Kind)]
+	if len(compositions) == 0 {
+		return
+	}
+	props, ok := r.value["properties"].(map[string]any)
+	if !ok {
+		return
+	}
+	config, ok := props["config"].(map[string]any)
+	if !ok {
+		return
+	}
+	configProps, ok := config["properties"].(map[string]any)
+	if !ok {
+		configProps = make(map[string]any)
+		config["properties"] = configProps
+	}
+
+	log.Printf("adding %d compositions to %s", len(compositions), r.name)
+	switch c.Compositions {
+	case CompositionSelector:
+		configProps["compositionSelector"] = compositionSelectorField(compositions)
+	default:
+		configProps["compositionRef"] = compositionRefField(compositions)
+	}
+}
+
+// compositionRefField lets users choose a composition by name. Options show the description and labels of each
+// composition.
+func compositionRefField(compositions []models.Composition) map[string]any {
+	options := make([]any, 0, len(compositions))
+	for _, comp := range compositions {
+		options = append(options, map[string]any{
+			"const": comp.Metadata.Name,
+			"title": compositionTitle(comp),
+		})
+	}
+	name := map[string]any{
+		"type":  "string",
+		"title": "Composition",
+		"oneOf": options,
+	}
+	if len(compositions) == 1 {
+		name["default"] = compositions[0].Metadata.Name
+	}
+	return map[string]any{
+		"type":        "object",
+		"title":       "Composition",
+		"description": "The composition implementing this resource",
+		"properties": map[string]any{
+			"name": name,
+		},
+	}
+}
+
+// compositionSelectorField lets users choose compositions by their labels. Every label key becomes a field offering
+// the values used by the compositions.
+func compositionSelectorField(compositions []models.Composition) map[string]any {
+	values := make(map[string][]any)
+	for _, comp := range compositions {
+		for k, v := range comp.Metadata.Labels {
+			values[k] = appendUnique(values[k], v)
+		}
+	}
+	labels := make(map[string]any, len(values))
+	for _, k := range sortedKeys(values) {
+		vs := values[k]
+		sort.Slice(vs, func(i, j int) bool { return vs[i].(string) < vs[j].(string) })
+		label := map[string]any{
+			"type": "string",
+			"enum": vs,
+		}
+		if len(vs) == 1 {
+			label["default"] = vs[0]
+		}
+		labels[k] = label
+	}
+	names := make([]string, 0, len(compositions))
+	for _, comp := range compositions {
+		names = append(names, compositionTitle(comp))
+	}
+	return map[string]any{
+		"type":        "object",
+		"title":       "Composition",
+		"description": fmt.Sprintf("Labels selecting the composition implementing this resource. Available compositions: %s", strings.Join(names, "; ")),
+		"properties": map[string]any{
+			"matchLabels": map[string]any{
+				"type":       "object",
+				"properties": labels,
+			},
+		},
+	}
+}
+
+// compositionTitle returns the name of the composition followed by its description or, without one, its labels.
+func compositionTitle(comp models.Composition) string {
+	if d := comp.Metadata.Annotations[CompositionDescriptionAnnotation]; d != "" {
+		return fmt.Sprintf("%s: %s", comp.Metadata.Name, d)
+	}
+	if len(comp.Metadata.Labels) == 0 {
+		return comp.Metadata.Name
+	}
+	labels := make([]string, 0, len(comp.Metadata.Labels))
+	for _, k := range sortedKeys(comp.Metadata.Labels) {
+		labels = append(labels, fmt.Sprintf("%s=%s", k, comp.Metadata.Labels[k]))
+	}
+	return fmt.Sprintf("%s (%s)", comp.Metadata.Name, strings.Join(labels, ", "))
+}
@@ -1,74 +1,160 @@
 package cmd
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"github.com/cnoe-io/cnoe-cli/pkg/lib"
 	"github.com/cnoe-io/cnoe-cli/pkg/models"
 	"github.com/spf13/cobra"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
 	"sigs.k8s.io/yaml"
 )
 
 const (
-	KindXRD = "CompositeResourceDefinition"
-	KindCRD = "CustomResourceDefinition"
+	KindXRD  = "CompositeResourceDefinition"
+	KindCRD  = "CustomResourceDefinition"
+	KindList = "List"
 )
 
 var (
 	verifiers []string
 
-	templateName        string
-	templateTitle       string
-	templateDescription string
+	allVersions    bool
+	skipDeprecated bool
+	normalize      bool
+	filterFile     string
+	compositions   string
+
+	fromCluster   bool
+	crdKubeConfig string
+	groups        []string
+	labelSelector string
+	categories    []string
 )
 
 func init() {
 	templateCmd.AddCommand(crdCmd)
 	crdCmd.Flags().StringArrayVarP(&verifiers, "verifier", "v", []string{}, "list of verifiers to test the resource against")
-
-	crdCmd.Flags().StringVarP(&templateName, "templateName", "", "", "sets the name of the template")
-	crdCmd.Flags().StringVarP(&templateTitle, "templateTitle", "", "", "sets the title of the template")
-	crdCmd.Flags().StringVarP(&templateDescription, "templateDescription", "", "", "sets the description of the template")
+	crdCmd.Flags().BoolVarP(&allVersions, "allVersions", "", false, "generate one template per served version instead of only the storage version")
+	crdCmd.Flags().BoolVarP(&skipDeprecated, "skipDeprecated", "", false, "do not generate templates for deprecated versions")
+	crdCmd.Flags().StringVarP(&filterFile, "filterFile", "", "", "path to a file with per group/kind include and exclude rules for generated fields")
+	crdCmd.Flags().StringVarP(&compositions, "compositions", "", "", "add a field choosing among the Compositions found for an XRD: ref (compositionRef by name) or selector (compositionSelector labels). Disabled by default")
+	crdCmd.Flags().BoolVarP(&fromCluster, "fromCluster", "", false, "read CRDs and XRDs from the cluster of the kubeconfig instead of the input directory")
+	crdCmd.Flags().StringVarP(&crdKubeConfig, "kubeconfig", "", "", "path to the kubeconfig file used with fromCluster, defaults to KUBECONFIG or ~/.kube/config")
+	crdCmd.Flags().StringSliceVarP(&groups, "groups", "", []string{}, "only read definitions of these API groups from the cluster")
+	crdCmd.Flags().StringVarP(&labelSelector, "selector", "l", "", "label selector for the definitions read from the cluster")
+	crdCmd.Flags().StringSliceVarP(&categories, "categories", "", []string{}, "only read definitions in one of these categories from the cluster")
+	crdCmd.Flags().BoolVarP(&normalize, "normalize", "", false, "rewrite $ref, allOf/anyOf/oneOf and x-kubernetes-* extensions into forms Backstage renders well")
 }
 
 var (
 	crdCmd = &cobra.Command{
-		Use:     "crd",
-		Short:   "Generate backstage templates from CRD/XRD",
-		Long:    `Generate backstage templates from supplied CRD and XRD definitions`,
-		PreRunE: templatePreRunE,
-		RunE:    crd,
+		Use:          "crd",
+		Short:        "Generate backstage templates from CRD/XRD",
+		Long:         `Generate backstage templates from supplied CRD and XRD definitions`,
+		PreRunE:      crdPreRunE,
+		RunE:         crd,
+		SilenceUsage: true,
 	}
 )
 
+// crdPreRunE allows omitting the input directory when definitions are read from the cluster.
+func crdPreRunE(cmd *cobra.Command, args []string) error {
+	if fromCluster && inputDir == "" {
+		if err := optionalInputDir(cmd); err != nil {
+			return err
+		}
+		return checkTemplateFlags()
+	}
+	return templatePreRunE(cmd, args)
+}
+
 func crd(cmd *cobra.Command, args []string) error {
-	return Process(
-		cmd.Context(),
-		NewCRDModule(
-			inputDir, outputDir, templatePath, insertionPoint, collapsed, raw,
-			verifiers, templateName, templateTitle, templateDescription,
-		),
+	if (splitBy != "" || pagesFile != "") && stepsProfile == "" {
+		return errors.New("steps flag must be specified when splitting CRDs into pages, since the configuration is spread over several parameters")
+	}
+	if compositions != "" && compositions != CompositionRef && compositions != CompositionSelector {
+		return fmt.Errorf("unsupported value %q for compositions. supported values are %s, %s", compositions, CompositionRef, CompositionSelector)
+	}
+	m := NewCRDModule(
+		inputDir, outputDir, templatePath, insertionPoint, collapsed, raw,
+		verifiers, templateName, templateTitle, templateDescription,
 	)
+	m.AllVersions = allVersions
+	m.SkipDeprecated = skipDeprecated
+	m.Normalize = normalize
+	m.Compositions = compositions
+	if fromCluster {
+		config := crdKubeConfig
+		if config == "" {
+			var err error
+			config, err = defaultKubeConfig()
+			if err != nil {
+				return err
+			}
+		}
+		cli, err := lib.NewK8sClient(config)
+		if err != nil {
+			return err
+		}
+		m.Client = cli
+		m.ClusterSelector = lib.DefinitionSelector{
+			Groups:        groups,
+			LabelSelector: labelSelector,
+			Categories:    categories,
+		}
+	}
+	if err := applyTemplateFlags(&m.EntityConfig); err != nil {
+		return err
+	}
+	if filterFile != "" {
+		filters, err := LoadFieldFilters(filterFile)
+		if err != nil {
+			return err
+		}
+		m.FieldFilters = filters
+	}
+	return Process(cmd.Context(), m)
 }
 
 type CRDModule struct {
 	EntityConfig
-	verifiers           []string
-	templateName        string
-	templateTitle       string
-	templateDescription string
+	verifiers []string
+
+	// AllVersions renders every served version instead of only the storage version.
+	AllVersions bool
+	// SkipDeprecated excludes deprecated versions from the generated templates.
+	SkipDeprecated bool
+	// Normalize rewrites schema constructs react-jsonschema-form does not render well.
+	Normalize bool
+	// FieldFilters curate which fields of the resource spec are shown in the form.
+	FieldFilters []models.FieldFilter
+	// Compositions adds a field choosing among the Compositions of an XRD found in the input, using CompositionRef or
+	// CompositionSelector. Empty disables it.
+	Compositions string
+	// Client reads the definitions matching ClusterSelector from a cluster, in addition to the input directory.
+	Client          lib.IK8sClient
+	ClusterSelector lib.DefinitionSelector
+
+	compositions compositionIndex
+	cluster      map[string][]byte
 }
 
 func NewCRDModule(
 	inputDir, outputDir, templatePath, insertionPoint string, collapsed, raw bool,
 	verifiers []string, templateName, templateTitle, templateDescription string,
-) Entity {
+) *CRDModule {
 	return &CRDModule{
 		EntityConfig: EntityConfig{
 			InputDir:       inputDir,
@@ -77,11 +163,12 @@ func NewCRDModule(
 			InsertionPoint: insertionPoint,
 			Collapsed:      collapsed,
 			Raw:            raw,
+
+			TemplateName:        templateName,
+			TemplateTitle:       templateTitle,
+			TemplateDescription: templateDescription,
 		},
-		verifiers:           verifiers,
-		templateName:        templateName,
-		templateTitle:       templateTitle,
-		templateDescription: templateDescription,
+		verifiers: verifiers,
 	}
 }
 
@@ -89,67 +176,194 @@ func (c *CRDModule) Config() EntityConfig {
 	return c.EntityConfig
 }
 
-func (c *CRDModule) GetDefinitions(inputDir string, currentDepth uint32) ([]string, error) {
+func (c *CRDModule) GetDefinitions(ctx context.Context, inputDir string, currentDepth uint32) ([]string, error) {
 	if currentDepth > depth {
 		return nil, nil
 	}
-	out, err := getRelevantFiles(inputDir, currentDepth, c.findDefs)
-	if err != nil {
-		return nil, err
+	out := make([]string, 0)
+	if c.InputDir != "" {
+		files, err := getRelevantFiles(ctx, inputDir, currentDepth, c.findDefs)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, files...)
+	}
+	if currentDepth > 0 {
+		return out, nil
+	}
+	if c.Client != nil {
+		defs, err := c.clusterDefinitions(ctx)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, defs...)
+	}
+	if c.Compositions != "" {
+		c.compositions = readCompositions(out, c.readDefinition)
 	}
 	return out, nil
 }
 
-func (c *CRDModule) findDefs(file os.DirEntry, currentDepth uint32, base string) ([]string, error) {
+func (c *CRDModule) findDefs(ctx context.Context, file os.DirEntry, currentDepth uint32, base string) ([]string, error) {
 	f := filepath.Join(base, file.Name())
 	stat, err := os.Stat(f)
 	if err != nil {
 		return nil, err
 	}
 	if stat.IsDir() {
-		df, err := c.GetDefinitions(f, currentDepth+1)
+		df, err := c.GetDefinitions(ctx, f, currentDepth+1)
 		if err != nil {
 			return nil, err
 		}
 		return df, nil
 	}
+	if isOverlayFile(f) {
+		return nil, nil
+	}
 	return []string{f}, nil
 }
 
-func (c *CRDModule) HandleEntry(ctx context.Context, def, expectedOutDir, templateFile string) (any, string, error) {
+func (c *CRDModule) HandleEntry(ctx context.Context, def, expectedOutDir, templateFile string) ([]EntityOutput, error) {
 	log.Printf("processing resource at %s", def)
-	converted, resourceName, err := c.convert(def)
+	resources, err := c.convert(def)
 	if err != nil {
 		var e NotSupported
 		if errors.As(err, &e) {
-			return nil, "", nil
+			return nil, nil
 		}
-		return nil, "", err
+		return nil, err
 	}
 
-	fileName := filepath.Join(expectedOutDir, fmt.Sprintf("%s.yaml", strings.ToLower(resourceName)))
-	content, err := c.createContent(ctx, converted, templateFile)
+	var hints uiRules
+	if c.UIRules != nil {
+		hints, err = c.uiHints()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	outputs := make([]EntityOutput, 0, len(resources))
+	for _, r := range resources {
+		if err := c.filterFields(r); err != nil {
+			return nil, err
+		}
+		c.addCompositions(r)
+		if c.Normalize {
+			var changes []string
+			r.value, changes = normalizeSchema(r.value, r.value)
+			for i := range changes {
+				log.Printf("normalized %s %s", r.name, changes[i])
+			}
+		}
+		if c.UIRules != nil {
+			c.addUIHints(hints, r)
+		}
+		fileName := filepath.Join(expectedOutDir, fmt.Sprintf("%s.yaml", strings.ToLower(r.name)))
+		content, err := c.createContent(ctx, r, templateFile)
+		if err != nil {
+			log.Printf("failed to write %s: %s \n", def, err.Error())
+			return nil, err
+		}
+		outputs = append(outputs, EntityOutput{
+			Content:    content,
+			FileName:   fileName,
+			Source:     def,
+			Definition: fmt.Sprintf("%s/%s, Kind=%s", r.doc.Spec.Group, r.version.Name, r.doc.Spec.Names.Kind),
+		})
+	}
+
+	return outputs, nil
+}
+
+// filterFields applies the matching field filters to the resource configuration.
+func (c *CRDModule) filterFields(r crdResource) error {
+	kinds := []string{r.doc.Spec.Names.Kind}
+	if r.doc.Spec.ClaimNames != nil {
+		kinds = append(kinds, r.doc.Spec.ClaimNames.Kind)
+	}
+	filters := matchingFilters(c.FieldFilters, r.doc.Spec.Group, kinds...)
+	if len(filters) == 0 {
+		return nil
+	}
+	config, found, err := unstructured.NestedMap(r.value, "properties", "config")
 	if err != nil {
-		log.Printf("failed to write %s: %s \n", def, err.Error())
-		return nil, "", err
+		return fmt.Errorf("failed to filter fields of %s: %w", r.name, err)
+	}
+	if !found {
+		log.Printf("%s does not have a configuration to filter", r.name)
+		return nil
 	}
+	for _, f := range filters {
+		config = newFieldFilter(f).filterSchema(config)
+	}
+	return unstructured.SetNestedMap(r.value, config, "properties", "config")
+}
 
-	return content, fileName, nil
+// addUIHints infers ui:* hints for the resource configuration.
+func (c *CRDModule) addUIHints(hints uiRules, r crdResource) {
+	props, ok := r.value["properties"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	if config, ok := props["config"].(map[string]interface{}); ok {
+		props["config"] = hints.applyUIHints("config", config)
+	}
 }
 
-func (c *CRDModule) createContent(ctx context.Context, converted any, templateFile string) (any, error) {
+func (c *CRDModule) createContent(ctx context.Context, r crdResource, templateFile string) (any, error) {
 	if shouldCreateNonCollapsedTemplate(c) {
 		input := insertAtInput{
 			templatePath:     templateFile,
 			jqPathExpression: c.InsertionPoint,
+			insertions:       c.Insertions,
+		}
+		var err error
+		input.metadata, input.owner, err = c.templateMetadata(r.templateValues(), true)
+		if err != nil {
+			return nil, err
 		}
-		props := converted.(map[string]any)
+		props := r.value
 		if v, reqOk := props["required"]; reqOk {
 			if reqs, ok := v.([]string); ok {
 				input.required = reqs
 			}
 		}
 		input.fields = props
+		var configFields map[string]string
+		if c.SplitBy != "" {
+			fields, pages, split, err := c.splitConfig(props)
+			if err != nil {
+				return nil, err
+			}
+			if len(pages) > 0 && c.Steps == "" {
+				// steps written by hand only know the config parameter and would drop the fields on other pages
+				return nil, fmt.Errorf("the configuration of %s is split into several parameters. use a step profile to generate the steps reading them", r.name)
+			}
+			input.fields = fields
+			input.pages = pages
+			if len(pages) > 0 {
+				configFields = split
+			}
+		}
+		if c.Steps != "" {
+			profile, err := lookupStepProfile(crdStepProfiles, c.Steps)
+			if err != nil {
+				return nil, err
+			}
+			fields := make(map[string]any, len(input.fields))
+			for k, v := range input.fields {
+				fields[k] = v
+			}
+			properties := make(map[string]any)
+			for k, v := range fields["properties"].(map[string]any) {
+				properties[k] = v
+			}
+			fields["properties"] = properties
+			input.fields = fields
+			_, namespaced := properties["namespace"]
+			_, withVerifiers := properties["verifiers"]
+			profile.apply(&input, properties, stepInput{namespaced: namespaced, verifiers: withVerifiers, configFields: configFields})
+		}
 		converted, err := insertAt(ctx, input)
 		if err != nil {
 			return nil, err
@@ -157,45 +371,251 @@ func (c *CRDModule) createContent(ctx context.Context, converted any, templateFi
 		return converted, nil
 	}
 
-	return converted, nil
+	return r.value, nil
+}
+
+// crdResource is the converted schema of a single definition version.
+type crdResource struct {
+	name    string
+	value   map[string]interface{}
+	doc     models.Definition
+	version models.Version
 }
 
-func (c *CRDModule) convert(def string) (any, string, error) {
-	data, err := os.ReadFile(def)
+func (r crdResource) templateValues() templateValues {
+	kind := r.doc.Spec.Names.Kind
+	if r.doc.Spec.ClaimNames != nil {
+		kind = r.doc.Spec.ClaimNames.Kind
+	}
+	return templateValues{
+		Name:    strings.ToLower(r.name),
+		Title:   kind,
+		Group:   r.doc.Spec.Group,
+		Version: r.version.Name,
+		Kind:    kind,
+	}
+}
+
+// splitConfig splits the resource configuration into wizard pages. The first page keeps the resource identifiers.
+// Backstage merges the data of wizard pages shallowly, so every further page holds its part of the configuration in
+// a property of its own, config_2 for the second page and so on. The returned map tells the property each
+// configuration field ends up in.
+func (c *CRDModule) splitConfig(fields map[string]any) (map[string]any, []map[string]any, map[string]string, error) {
+	config, found, err := unstructured.NestedMap(fields, "properties", "config")
+	if err != nil || !found {
+		return fields, nil, nil, err
+	}
+	configProps, _ := config["properties"].(map[string]any)
+	required := make([]string, 0)
+	for _, r := range toSlice(config["required"]) {
+		if s, ok := r.(string); ok {
+			required = append(required, s)
+		}
+	}
+
+	first, rest, err := splitPages(c.SplitBy, c.Pages, configProps, required)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	configFields := make(map[string]string, len(configProps))
+	for name := range first.properties {
+		configFields[name] = "config"
+	}
+	firstConfig := make(map[string]any, len(config))
+	for k, v := range config {
+		firstConfig[k] = v
+	}
+	firstConfig["properties"] = first.properties
+	delete(firstConfig, "required")
+	if len(first.required) > 0 {
+		firstConfig["required"] = first.required
+	}
+	out := make(map[string]any, len(fields))
+	for k, v := range fields {
+		out[k] = v
+	}
+	props := make(map[string]any)
+	for k, v := range fields["properties"].(map[string]any) {
+		props[k] = v
+	}
+	props["config"] = trimOrder(firstConfig)
+	out["properties"] = props
+
+	pages := make([]map[string]any, len(rest))
+	for i, p := range rest {
+		param := fmt.Sprintf("config_%d", i+2)
+		for name := range p.properties {
+			configFields[name] = param
+		}
+		pageConfig := map[string]any{
+			"type":       "object",
+			"title":      config["title"],
+			"properties": p.properties,
+		}
+		if len(p.required) > 0 {
+			pageConfig["required"] = p.required
+		}
+		if order, ok := config[uiOrder]; ok {
+			pageConfig[uiOrder] = order
+		}
+		pages[i] = p.toParameters(map[string]any{param: trimOrder(pageConfig)}, nil)
+	}
+	return out, pages, configFields, nil
+}
+
+func (c *CRDModule) convert(def string) ([]crdResource, error) {
+	data, err := c.readDefinition(def)
 	if err != nil {
-		return nil, "", err
+		return nil, err
 	}
-	var doc models.Definition
-	err = yaml.Unmarshal(data, &doc)
+	docs, err := readDefinitions(data)
 	if err != nil {
 		log.Printf("failed to read %s. This file will be excluded. %s", def, err)
-		return nil, "", NotSupported{
+		return nil, NotSupported{
 			fmt.Errorf("%s is not a kubernetes file", def),
 		}
 	}
 
-	if !isXRD(doc) && !isCRD(doc) {
-		return nil, "", NotSupported{
-			fmt.Errorf("%s is not a CRD or XRD", def),
+	resources := make([]crdResource, 0)
+	for _, doc := range docs {
+		if !isXRD(doc) && !isCRD(doc) {
+			continue
+		}
+
+		versions := c.selectVersions(doc)
+		if len(versions) == 0 {
+			log.Printf("%s.%s in %s does not have any versions to render. It will be excluded.", doc.Spec.Group, doc.Spec.Names.Kind, def)
+			continue
+		}
+
+		for _, version := range versions {
+			r, err := c.convertVersion(doc, version)
+			if err != nil {
+				return nil, err
+			}
+			resources = append(resources, r)
+		}
+	}
+
+	if len(resources) == 0 {
+		return nil, NotSupported{
+			fmt.Errorf("%s does not contain a CRD or XRD", def),
+		}
+	}
+	return resources, nil
+}
+
+// readDefinitions splits the given data into its yaml documents and expands `kind: List` items.
+// Documents that cannot be parsed as kubernetes objects are skipped.
+func readDefinitions(data []byte) ([]models.Definition, error) {
+	raws, err := readDocuments(data)
+	if err != nil {
+		return nil, err
+	}
+	docs := make([]models.Definition, 0, len(raws))
+	for _, raw := range raws {
+		var doc models.Definition
+		err = yaml.Unmarshal(raw, &doc)
+		if err != nil {
+			log.Printf("skipping document that is not a kubernetes object: %s", err)
+			continue
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+// readDocuments splits the given data into its yaml documents and expands `kind: List` items.
+func readDocuments(data []byte) ([][]byte, error) {
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(data)))
+	docs := make([][]byte, 0)
+	for {
+		raw, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(bytes.TrimSpace(raw)) == 0 {
+			continue
+		}
+
+		var list struct {
+			Kind  string            `json:"kind"`
+			Items []json.RawMessage `json:"items"`
+		}
+		err = yaml.Unmarshal(raw, &list)
+		if err != nil {
+			log.Printf("skipping document that is not a kubernetes object: %s", err)
+			continue
+		}
+		if list.Kind == KindList {
+			for _, item := range list.Items {
+				items, err := readDocuments(item)
+				if err != nil {
+					return nil, err
+				}
+				docs = append(docs, items...)
+			}
+			continue
+		}
+		docs = append(docs, raw)
+	}
+	return docs, nil
+}
+
+// selectVersions returns the versions of the definition to render. By default this is the storage version
+// (referenceable for XRDs), falling back to the first served version. With AllVersions every served version is returned.
+func (c *CRDModule) selectVersions(doc models.Definition) []models.Version {
+	candidates := make([]models.Version, 0, len(doc.Spec.Versions))
+	for _, v := range doc.Spec.Versions {
+		if !v.Served {
+			continue
+		}
+		if v.Deprecated && c.SkipDeprecated {
+			log.Printf("skipping deprecated version %s of %s.%s", v.Name, doc.Spec.Group, doc.Spec.Names.Kind)
+			continue
+		}
+		candidates = append(candidates, v)
+	}
+
+	if c.AllVersions || len(candidates) == 0 {
+		return candidates
+	}
+
+	for _, v := range candidates {
+		if v.Storage || v.Referenceable {
+			return []models.Version{v}
 		}
 	}
+	return candidates[:1]
+}
 
+func (c *CRDModule) convertVersion(doc models.Definition, version models.Version) (crdResource, error) {
 	var resourceName string
 	if doc.Spec.ClaimNames != nil {
 		resourceName = fmt.Sprintf("%s.%s", doc.Spec.Group, doc.Spec.ClaimNames.Kind)
 	} else {
 		resourceName = fmt.Sprintf("%s.%s", doc.Spec.Group, doc.Spec.Names.Kind)
 	}
+	if c.AllVersions {
+		resourceName = fmt.Sprintf("%s.%s", resourceName, version.Name)
+	}
 
-	var value map[string]interface{}
+	var (
+		value map[string]interface{}
+		err   error
+	)
 
-	v := doc.Spec.Versions[0].Schema.OpenAPIV3Schema.Properties["spec"]
+	v := version.Schema.OpenAPIV3Schema.Properties["spec"]
 	if v == nil {
-		value = doc.Spec.Versions[0].Schema.OpenAPIV3Schema.Properties
+		value = version.Schema.OpenAPIV3Schema.Properties
 	} else {
 		value, err = ConvertMap(v)
 		if err != nil {
-			return nil, "", err
+			return crdResource{}, err
 		}
 	}
 
@@ -211,24 +631,29 @@ func (c *CRDModule) convert(def string) (any, string, error) {
 	unstructured.SetNestedField(obj.Object, fmt.Sprintf("%s configuration options", resourceName), "properties", "config", "title")
 
 	// setting GVK for the resource
-	if len(doc.Spec.Versions) > 0 {
-		unstructured.SetNestedMap(obj.Object, map[string]interface{}{
-			"type":        "string",
-			"description": "APIVersion for the resource",
-			"default":     fmt.Sprintf("%s/%s", doc.Spec.Group, doc.Spec.Versions[0].Name),
-		},
-			"properties", "apiVersion")
-		kind := doc.Spec.Names.Kind
-		if doc.Spec.ClaimNames != nil {
-			kind = doc.Spec.ClaimNames.Kind
+	apiVersionDescription := "APIVersion for the resource"
+	if version.Deprecated {
+		apiVersionDescription = fmt.Sprintf("%s (deprecated)", apiVersionDescription)
+		if version.DeprecationWarning != nil {
+			apiVersionDescription = fmt.Sprintf("%s: %s", apiVersionDescription, *version.DeprecationWarning)
 		}
-		unstructured.SetNestedMap(obj.Object, map[string]interface{}{
-			"type":        "string",
-			"description": "Kind for the resource",
-			"default":     kind,
-		},
-			"properties", "kind")
 	}
+	unstructured.SetNestedMap(obj.Object, map[string]interface{}{
+		"type":        "string",
+		"description": apiVersionDescription,
+		"default":     fmt.Sprintf("%s/%s", doc.Spec.Group, version.Name),
+	},
+		"properties", "apiVersion")
+	kind := doc.Spec.Names.Kind
+	if doc.Spec.ClaimNames != nil {
+		kind = doc.Spec.ClaimNames.Kind
+	}
+	unstructured.SetNestedMap(obj.Object, map[string]interface{}{
+		"type":        "string",
+		"description": "Kind for the resource",
+		"default":     kind,
+	},
+		"properties", "kind")
 
 	// add a property to define the namespace for the resource
 	if doc.Spec.Scope == "Namespaced" {
@@ -255,7 +680,7 @@ func (c *CRDModule) convert(def string) (any, string, error) {
 		},
 			"properties", "verifiers")
 	}
-	return obj.Object, resourceName, nil
+	return crdResource{name: resourceName, value: obj.Object, doc: doc, version: version}, nil
 }
 
 func ConvertSlice(strSlice []string) []interface{} {
@@ -6,11 +6,20 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 
 	"github.com/cnoe-io/cnoe-cli/pkg/cmd"
+	"github.com/cnoe-io/cnoe-cli/pkg/lib"
+	"github.com/cnoe-io/cnoe-cli/pkg/lib/libfakes"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/onsi/gomega/gbytes"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"sigs.k8s.io/yaml"
 )
 
 var _ = Describe("Template CRDs", func() {
@@ -27,10 +36,29 @@ var _ = Describe("Template CRDs", func() {
 		templateDescription = "test-description"
 
 		inputDir             = "./fakes/crd/valid/input"
+		clusterGeneratedDir  = "./fakes/crd/cluster"
 		validOutputDir       = "./fakes/crd/valid/output"
 		invalidInputDir      = "./fakes/crd/invalid/input"
 		templateFile         = "./fakes/template/input-template.yaml"
 		expectedTemplateFile = "./fakes/crd/valid/output/full-template-oneof.yaml"
+
+		versionsInputDir  = "./fakes/crd/versions/input"
+		versionsOutputDir = "./fakes/crd/versions/output"
+		multiDocInputDir  = "./fakes/crd/multidoc/input"
+		normalizeInputDir = "./fakes/crd/normalize/input"
+		normalizeOutput   = "./fakes/crd/normalize/output/properties-example.cnoe.io.workload.yaml"
+		filterFile        = "./fakes/crd/filter/filters.yaml"
+		filterOutputDir   = "./fakes/crd/filter/output"
+		uiRulesFile       = "./fakes/ui/rules.yaml"
+		uiHintsOutput     = "./fakes/ui/output/properties-awsblueprints.io.cdn.yaml"
+		groupPagesOutput  = "./fakes/pages/output/full-template-group-awsblueprints.io.cdn.yaml"
+		k8sApplyOutput    = "./fakes/steps/output/full-template-k8s-apply-sparkoperator.k8s.io.sparkapplication.yaml"
+		catalogDir        = "./fakes/catalog"
+		compositionsInput = "./fakes/crd/compositions/input"
+		compositionsDir   = "./fakes/crd/compositions/output"
+		overlayInput      = "./fakes/overlay/input"
+		overlayShared     = "./fakes/overlay/shared"
+		overlayOutput     = "./fakes/overlay/output/full-template-awsblueprints.io.cdn.yaml"
 	)
 
 	BeforeEach(func() {
@@ -95,7 +123,7 @@ var _ = Describe("Template CRDs", func() {
 		})
 
 		It("should create valid backstage template for each definition", func() {
-			files, err := os.ReadDir(outputDir)
+			files, err := readOutputDir(outputDir)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(len(files)).To(Equal(2))
 			for i := range files {
@@ -119,9 +147,651 @@ var _ = Describe("Template CRDs", func() {
 		})
 
 		It("should not create any files", func() {
-			files, err := os.ReadDir(outputDir)
+			files, err := readOutputDir(outputDir)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(len(files)).To(Equal(0))
 		})
 	})
+
+	Context("with a definition that has multiple versions", func() {
+		var module *cmd.CRDModule
+
+		BeforeEach(func() {
+			module = cmd.NewCRDModule(versionsInputDir, outputDir, "", "", false, true,
+				[]string{}, templateName, templateTitle, templateDescription,
+			)
+		})
+
+		expectOutputs := func(names ...string) {
+			files, err := readOutputDir(outputDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(len(files)).To(Equal(len(names)))
+			for i := range names {
+				generated, err := os.ReadFile(filepath.Join(outputDir, names[i]))
+				Expect(err).NotTo(HaveOccurred())
+				expected, err := os.ReadFile(filepath.Join(versionsOutputDir, fmt.Sprintf("properties-%s", names[i])))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(generated).To(MatchYAML(expected))
+			}
+		}
+
+		It("should only render the storage version by default", func() {
+			Expect(cmd.Process(context.Background(), module)).To(Succeed())
+			expectOutputs("example.cnoe.io.database.yaml")
+		})
+
+		It("should render every served version and flag deprecated ones", func() {
+			module.AllVersions = true
+			Expect(cmd.Process(context.Background(), module)).To(Succeed())
+			expectOutputs("example.cnoe.io.database.v1alpha1.yaml", "example.cnoe.io.database.v1beta1.yaml")
+		})
+
+		It("should skip deprecated versions when asked to", func() {
+			module.AllVersions = true
+			module.SkipDeprecated = true
+			Expect(cmd.Process(context.Background(), module)).To(Succeed())
+			expectOutputs("example.cnoe.io.database.v1beta1.yaml")
+		})
+	})
+
+	Context("with multi-document files and lists", func() {
+		BeforeEach(func() {
+			err := cmd.Process(context.Background(), cmd.NewCRDModule(multiDocInputDir, outputDir, "", "", false, true,
+				[]string{}, templateName, templateTitle, templateDescription,
+			))
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should create one file per definition found", func() {
+			files, err := readOutputDir(outputDir)
+			Expect(err).NotTo(HaveOccurred())
+			names := make([]string, len(files))
+			for i := range files {
+				names[i] = files[i].Name()
+			}
+			Expect(names).To(ConsistOf(
+				"example.cnoe.io.bucket.yaml",
+				"example.cnoe.io.queue.yaml",
+				"example.cnoe.io.topic.yaml",
+			))
+		})
+	})
+
+	Context("with schema normalization enabled", func() {
+		BeforeEach(func() {
+			module := cmd.NewCRDModule(normalizeInputDir, outputDir, "", "", false, true,
+				[]string{}, templateName, templateTitle, templateDescription,
+			)
+			module.Normalize = true
+			Expect(cmd.Process(context.Background(), module)).To(Succeed())
+		})
+
+		It("should rewrite kubernetes extensions and combinators", func() {
+			generated, err := os.ReadFile(filepath.Join(outputDir, "example.cnoe.io.workload.yaml"))
+			Expect(err).NotTo(HaveOccurred())
+			expected, err := os.ReadFile(normalizeOutput)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(generated).To(MatchYAML(expected))
+		})
+
+		It("should keep the pattern of int-or-string fields or add one accepting numbers", func() {
+			generated, err := os.ReadFile(filepath.Join(outputDir, "example.cnoe.io.workload.yaml"))
+			Expect(err).NotTo(HaveOccurred())
+			var properties struct {
+				Properties struct {
+					Config struct {
+						Properties map[string]map[string]any `json:"properties"`
+					} `json:"config"`
+				} `json:"properties"`
+			}
+			Expect(yaml.Unmarshal(generated, &properties)).To(Succeed())
+			fields := properties.Properties.Config.Properties
+			Expect(fields["replicas"]).To(HaveKeyWithValue("pattern", "^[0-9]+%?$"))
+			Expect(fields["maxSurge"]).To(HaveKeyWithValue("type", "string"))
+			pattern := regexp.MustCompile(fields["maxSurge"]["pattern"].(string))
+			Expect(pattern.MatchString("3")).To(BeTrue())
+			Expect(pattern.MatchString("25%")).To(BeTrue())
+			Expect(pattern.MatchString("")).To(BeFalse())
+			Expect(pattern.MatchString("two words")).To(BeFalse())
+		})
+
+		It("should report what was changed", func() {
+			Expect(stdout).To(gbytes.Say("x-kubernetes-int-or-string converted to string"))
+			Expect(stdout).To(gbytes.Say("removed validation only oneOf"))
+		})
+	})
+
+	Context("with field filters", func() {
+		BeforeEach(func() {
+			module := cmd.NewCRDModule(inputDir, outputDir, "", "", false, true,
+				[]string{}, templateName, templateTitle, templateDescription,
+			)
+			filters, err := cmd.LoadFieldFilters(filterFile)
+			Expect(err).NotTo(HaveOccurred())
+			module.FieldFilters = filters
+			Expect(cmd.Process(context.Background(), module)).To(Succeed())
+		})
+
+		It("should only render the selected fields", func() {
+			files, err := readOutputDir(outputDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(len(files)).To(Equal(2))
+			for i := range files {
+				generated, err := os.ReadFile(filepath.Join(outputDir, files[i].Name()))
+				Expect(err).NotTo(HaveOccurred())
+				expected, err := os.ReadFile(filepath.Join(filterOutputDir, fmt.Sprintf("properties-%s", files[i].Name())))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(generated).To(MatchYAML(expected))
+			}
+		})
+	})
+
+	Context("with ui hints enabled", func() {
+		BeforeEach(func() {
+			module := cmd.NewCRDModule(inputDir, outputDir, "", "", false, true,
+				[]string{}, templateName, templateTitle, templateDescription,
+			)
+			rules, err := cmd.LoadUIRules(uiRulesFile)
+			Expect(err).NotTo(HaveOccurred())
+			module.UIRules = rules
+			Expect(cmd.Process(context.Background(), module)).To(Succeed())
+		})
+
+		It("should add ui hints inferred from the schema and the rules file", func() {
+			generated, err := os.ReadFile(filepath.Join(outputDir, "awsblueprints.io.cdn.yaml"))
+			Expect(err).NotTo(HaveOccurred())
+			expected, err := os.ReadFile(uiHintsOutput)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(generated).To(MatchYAML(expected))
+		})
+	})
+
+	Context("with pages split by group", func() {
+		BeforeEach(func() {
+			module := cmd.NewCRDModule(inputDir, outputDir, templateFile, ".spec.parameters[0]", false, false,
+				[]string{}, templateName, templateTitle, templateDescription,
+			)
+			module.SplitBy = cmd.SplitByGroup
+			module.Steps = cmd.StepProfileGitHubPR
+			Expect(cmd.Process(context.Background(), module)).To(Succeed())
+		})
+
+		It("should render top-level objects of the configuration as separate pages", func() {
+			generated, err := os.ReadFile(filepath.Join(outputDir, "awsblueprints.io.cdn.yaml"))
+			Expect(err).NotTo(HaveOccurred())
+			expected, err := os.ReadFile(groupPagesOutput)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(generated).To(MatchYAML(expected))
+		})
+	})
+
+	Context("with pages split by group and no step profile", func() {
+		It("should fail since hand-written steps would miss the configuration of later pages", func() {
+			module := cmd.NewCRDModule(inputDir, outputDir, templateFile, ".spec.parameters[0]", false, false,
+				[]string{}, templateName, templateTitle, templateDescription,
+			)
+			module.SplitBy = cmd.SplitByGroup
+			err := cmd.Process(context.Background(), module)
+			Expect(err).To(MatchError(ContainSubstring("split into several parameters")))
+		})
+	})
+
+	Context("with pages split by group and the k8s-apply step profile", func() {
+		It("should build the spec from the configuration of every page", func() {
+			module := cmd.NewCRDModule(inputDir, outputDir, templateFile, ".spec.parameters[0]", false, false,
+				[]string{}, templateName, templateTitle, templateDescription,
+			)
+			module.SplitBy = cmd.SplitByGroup
+			module.Steps = cmd.StepProfileK8sApply
+			Expect(cmd.Process(context.Background(), module)).To(Succeed())
+
+			data, err := os.ReadFile(filepath.Join(outputDir, "awsblueprints.io.cdn.yaml"))
+			Expect(err).NotTo(HaveOccurred())
+			var template struct {
+				Spec struct {
+					Parameters []map[string]any `json:"parameters"`
+					Steps      []map[string]any `json:"steps"`
+				} `json:"spec"`
+			}
+			Expect(yaml.Unmarshal(data, &template)).To(Succeed())
+
+			pageParams := make([]string, 0)
+			for _, p := range template.Spec.Parameters {
+				for name := range p["properties"].(map[string]any) {
+					if strings.HasPrefix(name, "config") {
+						pageParams = append(pageParams, name)
+					}
+				}
+			}
+			Expect(pageParams).To(ConsistOf("config", "config_2"))
+
+			var spec map[string]any
+			for _, step := range template.Spec.Steps {
+				if step["id"] == "serialize" {
+					spec = step["input"].(map[string]any)["data"].(map[string]any)["spec"].(map[string]any)
+				}
+			}
+			Expect(spec).To(Equal(map[string]any{
+				"minSize":        "${{ parameters.config.minSize }}",
+				"resourceConfig": "${{ parameters.config_2.resourceConfig }}",
+			}))
+
+			// every field of the unsplit configuration reaches the step input
+			unsplit := filepath.Join(tempDir, "unsplit")
+			module = cmd.NewCRDModule(inputDir, unsplit, templateFile, ".spec.parameters[0]", false, false,
+				[]string{}, templateName, templateTitle, templateDescription,
+			)
+			Expect(cmd.Process(context.Background(), module)).To(Succeed())
+			data, err = os.ReadFile(filepath.Join(unsplit, "awsblueprints.io.cdn.yaml"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(yaml.Unmarshal(data, &template)).To(Succeed())
+			config := template.Spec.Parameters[0]["properties"].(map[string]any)["config"].(map[string]any)["properties"].(map[string]any)
+			Expect(config).NotTo(BeEmpty())
+			for field := range config {
+				Expect(spec).To(HaveKey(field))
+			}
+			Expect(spec).To(HaveLen(len(config)))
+		})
+	})
+
+	Context("with the k8s-apply step profile", func() {
+		BeforeEach(func() {
+			module := cmd.NewCRDModule(inputDir, outputDir, templateFile, ".spec.parameters[0]", false, false,
+				[]string{}, templateName, templateTitle, templateDescription,
+			)
+			module.Steps = cmd.StepProfileK8sApply
+			Expect(cmd.Process(context.Background(), module)).To(Succeed())
+		})
+
+		It("should generate steps matching the generated parameters", func() {
+			generated, err := os.ReadFile(filepath.Join(outputDir, "sparkoperator.k8s.io.sparkapplication.yaml"))
+			Expect(err).NotTo(HaveOccurred())
+			expected, err := os.ReadFile(k8sApplyOutput)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(generated).To(MatchYAML(expected))
+		})
+	})
+
+	Context("with an unknown step profile", func() {
+		It("should return an error", func() {
+			module := cmd.NewCRDModule(inputDir, outputDir, templateFile, ".spec.parameters[0]", false, false,
+				[]string{}, templateName, templateTitle, templateDescription,
+			)
+			module.Steps = cmd.StepProfileTFVarsPR
+			Expect(cmd.Process(context.Background(), module)).NotTo(Succeed())
+		})
+	})
+
+	Context("with catalog info enabled", func() {
+		It("should write a location listing every generated template", func() {
+			module := cmd.NewCRDModule(inputDir, outputDir, templateFile, ".spec.parameters[0]", false, false,
+				[]string{}, templateName, templateTitle, templateDescription,
+			)
+			module.CatalogInfo = true
+			module.CatalogName = "aws-resources"
+			Expect(cmd.Process(context.Background(), module)).To(Succeed())
+
+			generated, err := os.ReadFile(filepath.Join(outputDir, cmd.CatalogInfoFile))
+			Expect(err).NotTo(HaveOccurred())
+			expected, err := os.ReadFile(filepath.Join(catalogDir, "catalog-info.yaml"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(generated).To(MatchYAML(expected))
+		})
+
+		It("should write a location for the collapsed template and an index of the resources", func() {
+			module := cmd.NewCRDModule(inputDir, outputDir, templateFile, ".spec.parameters[0]", true, false,
+				[]string{}, templateName, templateTitle, templateDescription,
+			)
+			module.CatalogInfo = true
+			module.Index = true
+			Expect(cmd.Process(context.Background(), module)).To(Succeed())
+
+			generated, err := os.ReadFile(filepath.Join(outputDir, cmd.CatalogInfoFile))
+			Expect(err).NotTo(HaveOccurred())
+			expected, err := os.ReadFile(filepath.Join(catalogDir, "catalog-info-collapsed.yaml"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(generated).To(MatchYAML(expected))
+
+			generated, err = os.ReadFile(filepath.Join(outputDir, cmd.IndexFile))
+			Expect(err).NotTo(HaveOccurred())
+			expected, err = os.ReadFile(filepath.Join(catalogDir, "index-collapsed.yaml"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(generated).To(MatchYAML(expected))
+		})
+	})
+
+	Context("without template metadata", func() {
+		It("should derive a unique name and title for each resource", func() {
+			module := cmd.NewCRDModule(inputDir, outputDir, templateFile, ".spec.parameters[0]", false, false,
+				[]string{}, "", "", "",
+			)
+			module.TemplateTitle = "Create a {{.Kind}} ({{.Group}}/{{.Version}})"
+			Expect(cmd.Process(context.Background(), module)).To(Succeed())
+
+			for file, metadata := range map[string]map[string]string{
+				"awsblueprints.io.cdn.yaml": {
+					"name":  "awsblueprints.io.cdn",
+					"title": "Create a CDN (awsblueprints.io/v1alpha1)",
+				},
+				"sparkoperator.k8s.io.sparkapplication.yaml": {
+					"name":  "sparkoperator.k8s.io.sparkapplication",
+					"title": "Create a SparkApplication (sparkoperator.k8s.io/v1beta2)",
+				},
+			} {
+				generatedData, err := os.ReadFile(filepath.Join(outputDir, file))
+				Expect(err).NotTo(HaveOccurred())
+				var template struct {
+					Metadata map[string]string `json:"metadata"`
+				}
+				Expect(yaml.Unmarshal(generatedData, &template)).To(Succeed())
+				Expect(template.Metadata).To(HaveKeyWithValue("name", metadata["name"]))
+				Expect(template.Metadata).To(HaveKeyWithValue("title", metadata["title"]))
+			}
+		})
+	})
+
+	Context("with compositions next to an XRD", func() {
+		for _, mode := range []string{cmd.CompositionRef, cmd.CompositionSelector} {
+			mode := mode
+			It(fmt.Sprintf("should let users choose a composition with a %s field", mode), func() {
+				module := cmd.NewCRDModule(compositionsInput, outputDir, "", "", false, true,
+					[]string{}, "", "", "",
+				)
+				module.Compositions = mode
+				Expect(cmd.Process(context.Background(), module)).To(Succeed())
+
+				generatedData, err := os.ReadFile(filepath.Join(outputDir, "example.cnoe.io.database.yaml"))
+				Expect(err).NotTo(HaveOccurred())
+				expectedData, err := os.ReadFile(filepath.Join(compositionsDir, fmt.Sprintf("properties-%s.yaml", mode)))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(generatedData).To(MatchYAML(expectedData))
+			})
+		}
+	})
+
+	Context("with definitions read from a cluster", func() {
+		var definitions []runtime.Object
+
+		BeforeEach(func() {
+			definitions = nil
+			for _, f := range []string{"cdn.yaml", "sparkapp.yaml"} {
+				data, err := os.ReadFile(filepath.Join(inputDir, f))
+				Expect(err).NotTo(HaveOccurred())
+				obj := &unstructured.Unstructured{}
+				Expect(yaml.Unmarshal(data, &obj.Object)).To(Succeed())
+				definitions = append(definitions, obj)
+			}
+		})
+
+		It("should generate the same templates as for the definition files", func() {
+			client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+				lib.CRDResource: "CustomResourceDefinitionList",
+				lib.XRDResource: "CompositeResourceDefinitionList",
+			}, definitions...)
+			module := cmd.NewCRDModule("", outputDir, "", "", false, true,
+				[]string{}, "", "", "",
+			)
+			module.Client = lib.NewK8sClientForClients(nil, client)
+			module.ClusterSelector = lib.DefinitionSelector{Groups: []string{"awsblueprints.io"}}
+			module.Index = true
+			Expect(cmd.Process(context.Background(), module)).To(Succeed())
+
+			fromFiles := filepath.Join(tempDir, "files")
+			Expect(cmd.Process(context.Background(), cmd.NewCRDModule(inputDir, fromFiles, "", "", false, true,
+				[]string{}, "", "", "",
+			))).To(Succeed())
+
+			generatedData, err := os.ReadFile(filepath.Join(outputDir, "awsblueprints.io.cdn.yaml"))
+			Expect(err).NotTo(HaveOccurred())
+			expectedData, err := os.ReadFile(filepath.Join(fromFiles, "awsblueprints.io.cdn.yaml"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(generatedData).To(MatchYAML(expectedData))
+
+			_, err = os.Stat(filepath.Join(outputDir, "sparkoperator.k8s.io.sparkapplication.yaml"))
+			Expect(os.IsNotExist(err)).To(BeTrue())
+
+			index, err := os.ReadFile(filepath.Join(outputDir, cmd.IndexFile))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(index)).To(ContainSubstring("source: cluster:compositeresourcedefinitions/xcdns.awsblueprints.io"))
+		})
+
+		It("should skip the CRDs generated for XRDs", func() {
+			for _, f := range []string{"xcdns.awsblueprints.io.yaml", "cdns.awsblueprints.io.yaml"} {
+				data, err := os.ReadFile(filepath.Join(clusterGeneratedDir, f))
+				Expect(err).NotTo(HaveOccurred())
+				obj := &unstructured.Unstructured{}
+				Expect(yaml.Unmarshal(data, &obj.Object)).To(Succeed())
+				definitions = append(definitions, obj)
+			}
+			client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+				lib.CRDResource: "CustomResourceDefinitionList",
+				lib.XRDResource: "CompositeResourceDefinitionList",
+			}, definitions...)
+			module := cmd.NewCRDModule("", outputDir, "", "", false, true,
+				[]string{}, "", "", "",
+			)
+			module.Client = lib.NewK8sClientForClients(nil, client)
+			module.ClusterSelector = lib.DefinitionSelector{Groups: []string{"awsblueprints.io"}}
+			module.Index = true
+			Expect(cmd.Process(context.Background(), module)).To(Succeed())
+
+			index, err := os.ReadFile(filepath.Join(outputDir, cmd.IndexFile))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(index)).To(ContainSubstring("source: cluster:compositeresourcedefinitions/xcdns.awsblueprints.io"))
+			Expect(string(index)).NotTo(ContainSubstring("customresourcedefinitions/"))
+
+			_, err = os.Stat(filepath.Join(outputDir, "awsblueprints.io.xcdn.yaml"))
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+
+		It("should pass the selector to the client", func() {
+			client := &libfakes.FakeIK8sClient{}
+			client.DefinitionsReturns(nil, nil)
+			module := cmd.NewCRDModule("", outputDir, "", "", false, true,
+				[]string{}, "", "", "",
+			)
+			module.Client = client
+			module.ClusterSelector = lib.DefinitionSelector{LabelSelector: "app=test", Categories: []string{"crossplane"}}
+			Expect(cmd.Process(context.Background(), module)).To(Succeed())
+
+			Expect(client.DefinitionsCallCount()).To(Equal(1))
+			_, selector := client.DefinitionsArgsForCall(0)
+			Expect(selector).To(Equal(module.ClusterSelector))
+		})
+	})
+
+	Context("with overlays", func() {
+		It("should apply the overlays next to the input and in the overlay directory", func() {
+			module := cmd.NewCRDModule(overlayInput, outputDir, templateFile, ".spec.parameters[0]", false, false,
+				[]string{}, templateName, templateTitle, templateDescription,
+			)
+			module.OverlayDir = overlayShared
+			Expect(cmd.Process(context.Background(), module)).To(Succeed())
+
+			files, err := readOutputDir(outputDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(files).To(HaveLen(1))
+			generated, err := os.ReadFile(filepath.Join(outputDir, "awsblueprints.io.cdn.yaml"))
+			Expect(err).NotTo(HaveOccurred())
+			expected, err := os.ReadFile(overlayOutput)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(generated).To(MatchYAML(expected))
+		})
+
+		It("should apply the overlays for all templates to the collapsed template", func() {
+			input := filepath.Join(tempDir, "input")
+			Expect(os.Mkdir(input, 0755)).To(Succeed())
+			for _, f := range []string{"cdn.yaml", "_all.merge.yaml"} {
+				data, err := os.ReadFile(filepath.Join(overlayInput, f))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(os.WriteFile(filepath.Join(input, f), data, 0644)).To(Succeed())
+			}
+			step := []byte(`.spec.steps += [{id: "publish", name: "publish", action: "publish:github"}]`)
+			Expect(os.WriteFile(filepath.Join(input, "template.jq"), step, 0644)).To(Succeed())
+
+			module := cmd.NewCRDModule(input, outputDir, templateFile, ".spec.parameters[0]", true, false,
+				[]string{}, templateName, templateTitle, templateDescription,
+			)
+			module.OverlayDir = overlayShared
+			Expect(cmd.Process(context.Background(), module)).To(Succeed())
+
+			data, err := os.ReadFile(filepath.Join(outputDir, "template.yaml"))
+			Expect(err).NotTo(HaveOccurred())
+			var template struct {
+				Metadata struct {
+					Labels map[string]string `json:"labels"`
+					Tags   []string          `json:"tags"`
+				} `json:"metadata"`
+				Spec struct {
+					Type  string           `json:"type"`
+					Steps []map[string]any `json:"steps"`
+				} `json:"spec"`
+			}
+			Expect(yaml.Unmarshal(data, &template)).To(Succeed())
+			Expect(template.Metadata.Labels).To(HaveKeyWithValue("team", "platform"))
+			Expect(template.Metadata.Tags).To(Equal([]string{"aws"}))
+			Expect(template.Spec.Type).To(Equal("infrastructure"))
+			Expect(template.Spec.Steps).To(ContainElement(HaveKeyWithValue("id", "publish")))
+
+			resource, err := os.ReadFile(filepath.Join(outputDir, cmd.DefinitionsDir, "awsblueprints.io.cdn.yaml"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(resource)).NotTo(ContainSubstring("team: platform"))
+		})
+
+		It("should fail for overlays that cannot be applied", func() {
+			overlayDir := filepath.Join(tempDir, "overlays")
+			Expect(os.Mkdir(overlayDir, 0755)).To(Succeed())
+			patch := []byte("- op: remove\n  path: /spec/missing\n")
+			Expect(os.WriteFile(filepath.Join(overlayDir, "awsblueprints.io.cdn.patch.yaml"), patch, 0644)).To(Succeed())
+
+			module := cmd.NewCRDModule(overlayInput, outputDir, templateFile, ".spec.parameters[0]", false, false,
+				[]string{}, templateName, templateTitle, templateDescription,
+			)
+			module.OverlayDir = overlayDir
+			err := cmd.Process(context.Background(), module)
+			Expect(err).To(MatchError(ContainSubstring("awsblueprints.io.cdn.patch.yaml")))
+
+			files, err := readOutputDir(outputDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(files).To(BeEmpty())
+		})
+	})
+
+	Context("with pruning enabled after a run without it", func() {
+		It("should remove the files generated without pruning", func() {
+			input := filepath.Join(tempDir, "input")
+			Expect(os.Mkdir(input, 0755)).To(Succeed())
+			for _, f := range []string{"cdn.yaml", "sparkapp.yaml"} {
+				data, err := os.ReadFile(filepath.Join(inputDir, f))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(os.WriteFile(filepath.Join(input, f), data, 0644)).To(Succeed())
+			}
+			newModule := func() *cmd.CRDModule {
+				return cmd.NewCRDModule(input, outputDir, templateFile, ".spec.parameters[0]", false, false,
+					[]string{}, templateName, templateTitle, templateDescription,
+				)
+			}
+			Expect(cmd.Process(context.Background(), newModule())).To(Succeed())
+			stale := filepath.Join(outputDir, "sparkoperator.k8s.io.sparkapplication.yaml")
+			Expect(stale).To(BeAnExistingFile())
+
+			Expect(os.Remove(filepath.Join(input, "sparkapp.yaml"))).To(Succeed())
+			Expect(cmd.Process(context.Background(), newModule())).To(Succeed())
+			Expect(stale).To(BeAnExistingFile())
+
+			module := newModule()
+			module.Prune = true
+			Expect(cmd.Process(context.Background(), module)).To(Succeed())
+			Expect(stale).NotTo(BeAnExistingFile())
+			Expect(filepath.Join(outputDir, "awsblueprints.io.cdn.yaml")).To(BeAnExistingFile())
+		})
+	})
+
+	Context("with pruning enabled", func() {
+		var (
+			input string
+			out   *gbytes.Buffer
+		)
+
+		newModule := func() *cmd.CRDModule {
+			module := cmd.NewCRDModule(input, outputDir, templateFile, ".spec.parameters[0]", true, false,
+				[]string{}, templateName, templateTitle, templateDescription,
+			)
+			module.Prune = true
+			module.Out = out
+			return module
+		}
+
+		BeforeEach(func() {
+			out = gbytes.NewBuffer()
+			input = filepath.Join(tempDir, "input")
+			Expect(os.Mkdir(input, 0755)).To(Succeed())
+			for _, f := range []string{"cdn.yaml", "sparkapp.yaml"} {
+				data, err := os.ReadFile(filepath.Join(inputDir, f))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(os.WriteFile(filepath.Join(input, f), data, 0644)).To(Succeed())
+			}
+			Expect(cmd.Process(context.Background(), newModule())).To(Succeed())
+			Expect(os.Remove(filepath.Join(input, "sparkapp.yaml"))).To(Succeed())
+		})
+
+		It("should record the generated files in the manifest", func() {
+			manifest, err := os.ReadFile(filepath.Join(outputDir, cmd.ManifestFile))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(manifest).To(MatchYAML(`files:
+  - resources/awsblueprints.io.cdn.yaml
+  - resources/sparkoperator.k8s.io.sparkapplication.yaml
+  - template.yaml
+`))
+		})
+
+		It("should remove the files of definitions that are gone", func() {
+			notes := filepath.Join(outputDir, "resources", "notes.yaml")
+			Expect(os.WriteFile(notes, []byte("kept: true\n"), 0644)).To(Succeed())
+
+			Expect(cmd.Process(context.Background(), newModule())).To(Succeed())
+
+			files, err := os.ReadDir(filepath.Join(outputDir, "resources"))
+			Expect(err).NotTo(HaveOccurred())
+			names := make([]string, 0, len(files))
+			for _, f := range files {
+				names = append(names, f.Name())
+			}
+			Expect(names).To(ConsistOf("awsblueprints.io.cdn.yaml", "notes.yaml"))
+
+			template, err := os.ReadFile(filepath.Join(outputDir, "template.yaml"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(template)).NotTo(ContainSubstring("sparkoperator"))
+			manifest, err := os.ReadFile(filepath.Join(outputDir, cmd.ManifestFile))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(manifest)).NotTo(ContainSubstring("sparkoperator"))
+		})
+
+		It("should report the files to remove in dry-run mode", func() {
+			module := newModule()
+			module.DryRun = true
+			Expect(cmd.Process(context.Background(), module)).To(MatchError(cmd.ErrOutputChanged))
+			Expect(out).To(gbytes.Say(`remove\s+resources/sparkoperator\.k8s\.io\.sparkapplication\.yaml`))
+
+			_, err := os.Stat(filepath.Join(outputDir, "resources", "sparkoperator.k8s.io.sparkapplication.yaml"))
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should not record files that could not be written", func() {
+			Expect(os.Remove(filepath.Join(outputDir, cmd.ManifestFile))).To(Succeed())
+			blocked := filepath.Join(outputDir, "resources", "awsblueprints.io.cdn.yaml")
+			Expect(os.Remove(blocked)).To(Succeed())
+			Expect(os.Mkdir(blocked, 0755)).To(Succeed())
+			data, err := os.ReadFile(filepath.Join(inputDir, "sparkapp.yaml"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(os.WriteFile(filepath.Join(input, "sparkapp.yaml"), data, 0644)).To(Succeed())
+
+			Expect(cmd.Process(context.Background(), newModule())).To(MatchError(ContainSubstring("failed to write")))
+
+			manifest, err := os.ReadFile(filepath.Join(outputDir, cmd.ManifestFile))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(manifest)).To(ContainSubstring("sparkoperator.k8s.io.sparkapplication.yaml"))
+			Expect(string(manifest)).NotTo(ContainSubstring("awsblueprints.io.cdn.yaml"))
+		})
+	})
 })
@@ -0,0 +1,23 @@
+variable "tags" {
+  description = "Tags added to all resources"
+  type        = map(string)
+  default = {
+    env = "test"
+  }
+}
+
+variable "database" {
+  description = "Database settings"
+  type = object({
+    engine  = string
+    version = string
+    backup = optional(object({
+      enabled        = bool
+      retention_days = number
+    }), { enabled = true, retention_days = 7 })
+  })
+  default = {
+    engine  = "postgres"
+    version = "15"
+  }
+}
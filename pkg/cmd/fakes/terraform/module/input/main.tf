@@ -0,0 +1,18 @@
+terraform {
+  required_version = ">= 1.3"
+  required_providers {
+    aws = {
+      source  = "hashicorp/aws"
+      version = ">= 4.0"
+    }
+  }
+}
+
+module "logging" {
+  source  = "terraform-aws-modules/s3-bucket/aws"
+  version = "3.14.0"
+}
+
+resource "aws_s3_bucket" "this" {
+  bucket = var.name
+}
@@ -0,0 +1,14 @@
+output "arn" {
+  description = "ARN of the bucket"
+  value       = aws_s3_bucket.this.arn
+}
+
+output "id" {
+  value = aws_s3_bucket.this.id
+}
+
+output "secret" {
+  description = "Not really a secret"
+  value       = aws_s3_bucket.this.id
+  sensitive   = true
+}
@@ -0,0 +1,10 @@
+variable "name" {
+  description = "Name of the bucket"
+  type        = string
+}
+
+variable "versioning" {
+  description = "Enable versioning"
+  type        = bool
+  default     = true
+}
@@ -0,0 +1,37 @@
+variable "db_username" {
+  description = "Database user"
+  type        = string
+  default     = "admin"
+}
+
+variable "db_password" {
+  description = "Database password"
+  type        = string
+  default     = "changeme"
+  sensitive   = true
+}
+
+variable "api_token" {
+  type      = string
+  sensitive = true
+}
+
+variable "instance_class" {
+  description = "Instance class, the engine default is used when null"
+  type        = string
+  default     = null
+}
+
+variable "storage" {
+  description = "Allocated storage in GB"
+  type        = number
+  nullable    = false
+  default     = 20
+}
+
+variable "kms_key_id" {
+  description = "KMS key used to encrypt the storage"
+  type        = string
+  nullable    = false
+  default     = null
+}
@@ -0,0 +1,40 @@
+variable "node_groups" {
+  description = "Managed node groups"
+  type = map(object({
+    instance_types = list(string)
+    min_size       = optional(number, 1)
+    max_size       = optional(number, 3)
+    labels         = optional(map(string))
+    taints = optional(list(object({
+      key    = string
+      value  = optional(string)
+      effect = optional(string, "NoSchedule")
+    })), [])
+  }))
+}
+
+variable "cluster" {
+  description = "Cluster settings"
+  type = object({
+    name    = string
+    version = optional(string, "1.27")
+    logging = optional(object({
+      enabled = optional(bool, true)
+      types   = optional(set(string), ["api", "audit"])
+    }), {})
+  })
+}
+
+variable "subnet_range" {
+  description = "First and last IP of the subnet and its prefix length"
+  type        = tuple([string, string, number])
+  default     = ["10.0.0.1", "10.0.0.254", 24]
+}
+
+variable "matrix" {
+  type = list(list(number))
+}
+
+variable "extra" {
+  description = "Anything goes"
+}
@@ -0,0 +1,57 @@
+variable "environment" {
+  description = "Environment to deploy to"
+  type        = string
+  default     = "dev"
+
+  validation {
+    condition     = contains(["dev", "staging", "prod"], var.environment)
+    error_message = "Environment must be one of dev, staging or prod."
+  }
+}
+
+variable "bucket_name" {
+  description = "Name of the bucket"
+  type        = string
+
+  validation {
+    condition     = can(regex("^[a-z0-9.-]+$", var.bucket_name))
+    error_message = "Bucket names may only contain lower case letters, numbers, dots and hyphens."
+  }
+
+  validation {
+    condition     = length(var.bucket_name) >= 3 && length(var.bucket_name) <= 63
+    error_message = "Bucket names must be between 3 and 63 characters long."
+  }
+}
+
+variable "replicas" {
+  description = "Number of replicas"
+  type        = number
+  default     = 2
+
+  validation {
+    condition     = var.replicas >= 1 && var.replicas < 10
+    error_message = "Replicas must be between 1 and 9."
+  }
+}
+
+variable "availability_zones" {
+  description = "Availability zones to use"
+  type        = list(string)
+
+  validation {
+    condition     = 0 < length(var.availability_zones)
+    error_message = "At least one availability zone is required."
+  }
+}
+
+variable "cidr" {
+  description = "CIDR block of the network"
+  type        = string
+  default     = "10.0.0.0/16"
+
+  validation {
+    condition     = can(cidrhost(var.cidr, 0))
+    error_message = "Must be a valid CIDR block."
+  }
+}
@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/cnoe-io/cnoe-cli/pkg/models"
+	"sigs.k8s.io/yaml"
+)
+
+const anySegment = "*"
+
+func LoadFieldFilters(path string) ([]models.FieldFilter, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f models.FieldFilters
+	err = yaml.Unmarshal(data, &f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read filter file %s: %w", path, err)
+	}
+	for i := range f.Filters {
+		if f.Filters[i].Group == "" {
+			return nil, fmt.Errorf("filter %d in %s does not specify a group", i, path)
+		}
+	}
+	return f.Filters, nil
+}
+
+func matchingFilters(filters []models.FieldFilter, group string, kinds ...string) []models.FieldFilter {
+	out := make([]models.FieldFilter, 0)
+	for _, f := range filters {
+		if f.Group != group && f.Group != anySegment {
+			continue
+		}
+		if f.Kind == "" || f.Kind == anySegment {
+			out = append(out, f)
+			continue
+		}
+		for _, k := range kinds {
+			if strings.EqualFold(f.Kind, k) {
+				out = append(out, f)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// fieldFilter is a FieldFilter with its paths split into segments.
+type fieldFilter struct {
+	include  [][]string
+	exclude  [][]string
+	maxDepth int
+}
+
+func newFieldFilter(f models.FieldFilter) fieldFilter {
+	out := fieldFilter{maxDepth: f.MaxDepth}
+	for _, p := range f.Include {
+		out.include = append(out.include, splitFieldPath(p))
+	}
+	for _, p := range f.Exclude {
+		out.exclude = append(out.exclude, splitFieldPath(p))
+	}
+	return out
+}
+
+// splitFieldPath turns .a.b[*].c into [a b [*] c]. [] is accepted as a shorthand for [*].
+func splitFieldPath(p string) []string {
+	p = strings.ReplaceAll(p, "[]", "[*]")
+	p = strings.ReplaceAll(p, "[*]", ".[*]")
+	segments := make([]string, 0)
+	for _, s := range strings.Split(p, ".") {
+		if s != "" {
+			segments = append(segments, s)
+		}
+	}
+	return segments
+}
+
+// hasPrefix reports whether the first segments of path match prefix.
+func hasPrefix(path, prefix []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i := range prefix {
+		if prefix[i] != anySegment && prefix[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (f fieldFilter) keep(path []string) bool {
+	for _, e := range f.exclude {
+		if hasPrefix(path, e) {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, i := range f.include {
+		// keep included fields, everything under them, and their parents
+		if hasPrefix(path, i) || hasPrefix(i, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterSchema removes the fields of an object schema that are not selected by the filter.
+func (f fieldFilter) filterSchema(schema map[string]any) map[string]any {
+	return f.filterNode(schema, []string{}, 0)
+}
+
+func (f fieldFilter) filterNode(node map[string]any, path []string, depth int) map[string]any {
+	out := make(map[string]any, len(node))
+	for k, v := range node {
+		out[k] = v
+	}
+
+	if items, ok := out["items"].(map[string]any); ok {
+		out["items"] = f.filterNode(items, append(append([]string{}, path...), "[*]"), depth)
+	}
+
+	props, ok := out["properties"].(map[string]any)
+	if !ok {
+		return out
+	}
+	if f.maxDepth > 0 && depth >= f.maxDepth {
+		delete(out, "properties")
+		delete(out, "required")
+		return out
+	}
+
+	filtered := make(map[string]any, len(props))
+	for name, p := range props {
+		childPath := append(append([]string{}, path...), name)
+		if !f.keep(childPath) {
+			continue
+		}
+		if child, ok := p.(map[string]any); ok {
+			filtered[name] = f.filterNode(child, childPath, depth+1)
+		} else {
+			filtered[name] = p
+		}
+	}
+	out["properties"] = filtered
+
+	if required := toSlice(out["required"]); required != nil {
+		kept := make([]any, 0, len(required))
+		for _, r := range required {
+			if name, ok := r.(string); ok {
+				if _, found := filtered[name]; !found {
+					continue
+				}
+			}
+			kept = append(kept, r)
+		}
+		out["required"] = kept
+	}
+	return out
+}
@@ -0,0 +1,356 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+const (
+	ChartFile        = "Chart.yaml"
+	ValuesFile       = "values.yaml"
+	ValuesSchemaFile = "values.schema.json"
+)
+
+var (
+	// ## @param image.registry [default: REGISTRY_NAME] Image registry
+	paramComment = regexp.MustCompile(`^#+\s*@param\s+(\S+)\s+(?:\[[^\]]*\]\s*)?(.*)$`)
+
+	helmCmd = &cobra.Command{
+		Use:   "helm",
+		Short: "Generate backstage templates from Helm charts",
+		Long: "Generate backstage templates by walking the given input directory, find Helm charts, " +
+			"then create output file per chart.\n" +
+			"The form is generated from values.schema.json if the chart has one. Otherwise it is inferred from " +
+			"values.yaml, using # @param comments as descriptions.",
+		PreRunE:      templatePreRunE,
+		RunE:         helm,
+		SilenceUsage: true,
+	}
+)
+
+func init() {
+	templateCmd.AddCommand(helmCmd)
+	helmCmd.Flags().BoolVarP(&normalize, "normalize", "", false, "rewrite $ref, allOf/anyOf/oneOf and x-kubernetes-* extensions of values schemas into forms Backstage renders well")
+}
+
+func helm(cmd *cobra.Command, args []string) error {
+	m := NewHelmChart(inputDir, outputDir, templatePath, insertionPoint, collapsed, raw)
+	m.Normalize = normalize
+	if err := applyTemplateFlags(&m.EntityConfig); err != nil {
+		return err
+	}
+	return Process(cmd.Context(), m)
+}
+
+type HelmChart struct {
+	EntityConfig
+
+	// Normalize rewrites constructs of values schemas react-jsonschema-form does not render well.
+	Normalize bool
+}
+
+func NewHelmChart(inputDir, outputDir, templatePath, insertionPoint string, collapsed, raw bool) *HelmChart {
+	return &HelmChart{
+		EntityConfig: EntityConfig{
+			InputDir:       inputDir,
+			OutputDir:      outputDir,
+			TemplateFile:   templatePath,
+			InsertionPoint: insertionPoint,
+			Collapsed:      collapsed,
+			Raw:            raw,
+		},
+	}
+}
+
+func (h *HelmChart) Config() EntityConfig {
+	return h.EntityConfig
+}
+
+// chartMetadata are the fields of Chart.yaml used for the generated templates.
+type chartMetadata struct {
+	Name        string `yaml:"name"`
+	Version     string `yaml:"version"`
+	Description string `yaml:"description"`
+}
+
+// GetDefinitions returns the chart directories. Subcharts in the charts directory of a chart are not returned.
+func (h *HelmChart) GetDefinitions(ctx context.Context, inputDir string, currentDepth uint32) ([]string, error) {
+	if currentDepth > depth {
+		return nil, nil
+	}
+	if isChart(inputDir) {
+		return []string{inputDir}, nil
+	}
+	out, err := getRelevantFiles(ctx, inputDir, currentDepth, h.findCharts)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (h *HelmChart) findCharts(ctx context.Context, file os.DirEntry, currentDepth uint32, base string) ([]string, error) {
+	f := filepath.Join(base, file.Name())
+	stat, err := os.Stat(f)
+	if err != nil {
+		return nil, err
+	}
+	if stat.IsDir() {
+		charts, err := h.GetDefinitions(ctx, f, currentDepth+1)
+		if err != nil {
+			return nil, err
+		}
+		return charts, nil
+	}
+	return nil, nil
+}
+
+func isChart(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, ChartFile))
+	return err == nil
+}
+
+func (h *HelmChart) HandleEntry(ctx context.Context, def, expectedOutDir, templateFile string) ([]EntityOutput, error) {
+	log.Printf("processing chart at %s", def)
+	chart, err := readChart(def)
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := h.valuesSchema(def)
+	if err != nil {
+		return nil, err
+	}
+	values["title"] = fmt.Sprintf("%s values", chart.Name)
+
+	if h.UIRules != nil {
+		hints, err := h.uiHints()
+		if err != nil {
+			return nil, err
+		}
+		values = hints.applyUIHints("values", values)
+	}
+
+	props := map[string]any{"values": values}
+	if shouldCreateCollapsedTemplate(h) {
+		props["resources"] = map[string]any{"enum": []any{chart.Name}}
+	}
+	obj := map[string]any{"properties": props}
+
+	content, err := h.createContent(ctx, chart, templateFile, obj)
+	if err != nil {
+		log.Printf("failed to write %s: %s \n", def, err.Error())
+		return nil, err
+	}
+
+	return []EntityOutput{{
+		Content:    content,
+		FileName:   filepath.Join(expectedOutDir, fmt.Sprintf("%s.yaml", chart.Name)),
+		Source:     def,
+		Definition: fmt.Sprintf("chart %s-%s", chart.Name, chart.Version),
+	}}, nil
+}
+
+func (h *HelmChart) createContent(ctx context.Context, chart chartMetadata, templateFile string, fields map[string]any) (any, error) {
+	if !shouldCreateNonCollapsedTemplate(h) {
+		return fields, nil
+	}
+	if h.SplitBy != "" {
+		return nil, errors.New("wizard pages are not supported for helm charts")
+	}
+	if h.Steps != "" {
+		return nil, errors.New("steps are not supported for helm charts")
+	}
+	input := insertAtInput{
+		templatePath:     templateFile,
+		jqPathExpression: h.InsertionPoint,
+		fields:           fields,
+		insertions:       h.Insertions,
+	}
+	var err error
+	input.metadata, input.owner, err = h.templateMetadata(templateValues{
+		Name:        chart.Name,
+		Title:       chart.Name,
+		Version:     chart.Version,
+		Description: chart.Description,
+	}, true)
+	if err != nil {
+		return nil, err
+	}
+	return insertAt(ctx, input)
+}
+
+func readChart(dir string) (chartMetadata, error) {
+	var chart chartMetadata
+	b, err := os.ReadFile(filepath.Join(dir, ChartFile))
+	if err != nil {
+		return chart, err
+	}
+	err = yamlv3.Unmarshal(b, &chart)
+	if err != nil {
+		return chart, fmt.Errorf("failed to read %s: %w", filepath.Join(dir, ChartFile), err)
+	}
+	if chart.Name == "" {
+		chart.Name = filepath.Base(dir)
+	}
+	return chart, nil
+}
+
+// valuesSchema returns the schema of the chart values, read from values.schema.json or inferred from values.yaml.
+func (h *HelmChart) valuesSchema(dir string) (map[string]any, error) {
+	b, err := os.ReadFile(filepath.Join(dir, ValuesSchemaFile))
+	if err == nil {
+		var schema map[string]any
+		err = json.Unmarshal(b, &schema)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", filepath.Join(dir, ValuesSchemaFile), err)
+		}
+		if h.Normalize {
+			var changes []string
+			schema, changes = normalizeSchema(schema, schema)
+			for i := range changes {
+				log.Printf("normalized %s %s", dir, changes[i])
+			}
+		}
+		// definitions are resolved by normalizing and not needed in the form
+		for _, k := range []string{"$schema", "$id", "definitions", "$defs"} {
+			delete(schema, k)
+		}
+		return schema, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	b, err = os.ReadFile(filepath.Join(dir, ValuesFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]any{"type": "object", "properties": map[string]any{}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return inferValuesSchema(b)
+}
+
+// inferValuesSchema infers a schema from the values file. Values become the defaults of their fields and the
+// descriptions are taken from # @param comments, falling back to the comment above a value.
+func inferValuesSchema(data []byte) (map[string]any, error) {
+	var doc yamlv3.Node
+	err := yamlv3.Unmarshal(data, &doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read values: %w", err)
+	}
+	if len(doc.Content) == 0 {
+		return map[string]any{"type": "object", "properties": map[string]any{}}, nil
+	}
+	return inferSchema("", doc.Content[0], paramDescriptions(data)), nil
+}
+
+func inferSchema(path string, node *yamlv3.Node, descriptions map[string]string) map[string]any {
+	switch node.Kind {
+	case yamlv3.AliasNode:
+		return inferSchema(path, node.Alias, descriptions)
+	case yamlv3.MappingNode:
+		if len(node.Content) == 0 {
+			// e.g. podAnnotations: {}
+			return (&schemaNormalizer{}).freeForm(nil)
+		}
+		props := make(map[string]any, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			p := valuesPath(path, key.Value)
+			schema := inferSchema(p, value, descriptions)
+			if d, ok := descriptions[p]; ok {
+				schema["description"] = d
+			} else if d := commentText(key.HeadComment); d != "" {
+				schema["description"] = d
+			}
+			props[key.Value] = schema
+		}
+		return map[string]any{
+			"type":       "object",
+			"properties": props,
+		}
+	case yamlv3.SequenceNode:
+		items := map[string]any{"type": "string"}
+		if len(node.Content) > 0 {
+			items = inferSchema(path+"[]", node.Content[0], descriptions)
+			delete(items, "default")
+		}
+		out := map[string]any{
+			"type":  "array",
+			"items": items,
+		}
+		var value []any
+		if err := node.Decode(&value); err == nil && len(value) > 0 {
+			out["default"] = value
+		}
+		return out
+	default:
+		out := map[string]any{"type": scalarType(node.Tag)}
+		var value any
+		if err := node.Decode(&value); err == nil && value != nil {
+			out["default"] = value
+		}
+		return out
+	}
+}
+
+func scalarType(tag string) string {
+	switch tag {
+	case "!!int":
+		return "integer"
+	case "!!float":
+		return "number"
+	case "!!bool":
+		return "boolean"
+	default:
+		return "string"
+	}
+}
+
+// paramDescriptions returns the descriptions of # @param comments by the path of the value they describe.
+func paramDescriptions(data []byte) map[string]string {
+	out := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		m := paramComment.FindStringSubmatch(strings.TrimSpace(scanner.Text()))
+		if m != nil && m[2] != "" {
+			out[m[1]] = strings.TrimSpace(m[2])
+		}
+	}
+	return out
+}
+
+// commentText returns the text of a comment block without the comment markers. Lines with annotations such as
+// @param or @section are ignored.
+func commentText(comment string) string {
+	lines := make([]string, 0)
+	for _, l := range strings.Split(comment, "\n") {
+		l = strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(l), "#"))
+		if l == "" || strings.HasPrefix(l, "@") {
+			continue
+		}
+		lines = append(lines, l)
+	}
+	return strings.Join(lines, " ")
+}
+
+// valuesPath returns the path of a value the way @param comments refer to it, e.g. image.registry.
+func valuesPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return fmt.Sprintf("%s.%s", path, key)
+}
@@ -0,0 +1,114 @@
+package cmd_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/cnoe-io/cnoe-cli/pkg/cmd"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("Helm Template", func() {
+	var (
+		tempDir   string
+		outputDir string
+
+		stdout *gbytes.Buffer
+	)
+
+	const (
+		inputRootDir         = "./fakes/helm/valid/input"
+		webappInputDir       = "./fakes/helm/valid/input/webapp"
+		expectedTemplateFile = "./fakes/helm/valid/output/full-template-webapp.yaml"
+		targetTemplateFile   = "./fakes/template/input-template.yaml"
+		expectedSchemaFile   = "./fakes/helm/valid/output/properties-schema.yaml"
+		expectedValuesFile   = "./fakes/helm/valid/output/properties-webapp.yaml"
+	)
+
+	BeforeEach(func() {
+		var err error
+		tempDir, err = os.MkdirTemp("", "test-temp")
+		Expect(err).NotTo(HaveOccurred())
+
+		outputDir = filepath.Join(tempDir, "output")
+		err = os.Mkdir(outputDir, 0755)
+		Expect(err).NotTo(HaveOccurred())
+
+		stdout = gbytes.NewBuffer()
+		log.SetOutput(stdout)
+	})
+
+	AfterEach(func() {
+		err := os.RemoveAll(tempDir)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	Context("with a root directory and no target template specified", func() {
+		BeforeEach(func() {
+			chart := cmd.NewHelmChart(inputRootDir, outputDir, "", "", false, true)
+			chart.Normalize = true
+			Expect(cmd.Process(context.Background(), chart)).To(Succeed())
+		})
+
+		It("should use the values schema of charts that have one", func() {
+			generatedData, err := os.ReadFile(fmt.Sprintf("%s/schema.yaml", outputDir))
+			Expect(err).NotTo(HaveOccurred())
+			expectedData, err := os.ReadFile(expectedSchemaFile)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(generatedData).To(MatchYAML(expectedData))
+		})
+
+		It("should infer the schema from the values file and its comments", func() {
+			generatedData, err := os.ReadFile(fmt.Sprintf("%s/webapp.yaml", outputDir))
+			Expect(err).NotTo(HaveOccurred())
+			expectedData, err := os.ReadFile(expectedValuesFile)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(generatedData).To(MatchYAML(expectedData))
+		})
+
+		It("should not generate templates for subcharts", func() {
+			files, err := readOutputDir(outputDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(files).To(HaveLen(2))
+		})
+	})
+
+	Context("with a target template specified", func() {
+		It("should create the template file with the chart values merged", func() {
+			Expect(cmd.Process(context.Background(), cmd.NewHelmChart(webappInputDir, outputDir, targetTemplateFile, ".spec.parameters[0]", false, false))).To(Succeed())
+
+			generatedData, err := os.ReadFile(fmt.Sprintf("%s/webapp.yaml", outputDir))
+			Expect(err).NotTo(HaveOccurred())
+			expectedData, err := os.ReadFile(expectedTemplateFile)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(generatedData).To(MatchYAML(expectedData))
+		})
+
+		It("should fail for step profiles", func() {
+			chart := cmd.NewHelmChart(webappInputDir, outputDir, targetTemplateFile, ".spec.parameters[0]", false, false)
+			chart.Steps = cmd.StepProfileK8sApply
+			Expect(cmd.Process(context.Background(), chart)).NotTo(Succeed())
+		})
+	})
+
+	Context("with collapsed templates", func() {
+		It("should list every chart in the template", func() {
+			chart := cmd.NewHelmChart(inputRootDir, outputDir, targetTemplateFile, ".spec.parameters[0]", true, false)
+			Expect(cmd.Process(context.Background(), chart)).To(Succeed())
+
+			template, err := os.ReadFile(filepath.Join(outputDir, "template.yaml"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(template)).To(ContainSubstring("- schema"))
+			Expect(string(template)).To(ContainSubstring("- webapp"))
+
+			files, err := os.ReadDir(filepath.Join(outputDir, cmd.DefinitionsDir))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(files).To(HaveLen(2))
+		})
+	})
+})
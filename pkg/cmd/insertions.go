@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/cnoe-io/cnoe-cli/pkg/models"
+	"github.com/itchyny/gojq"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	FragmentProperties   = "properties"
+	FragmentRequired     = "required"
+	FragmentDependencies = "dependencies"
+	FragmentSteps        = "steps"
+	FragmentMetadata     = "metadata"
+	FragmentOwner        = "owner"
+
+	// MergeDeep merges objects recursively and replaces other values. MergeAppend and MergePrepend add the elements
+	// of a list that are not present yet at the end or the start.
+	MergeDeep    = "deep"
+	MergeReplace = "replace"
+	MergeAppend  = "append"
+	MergePrepend = "prepend"
+)
+
+// defaultMerge is the merge used for fragments when the insertion does not specify one.
+var defaultMerge = map[string]string{
+	FragmentProperties:   MergeDeep,
+	FragmentRequired:     MergeAppend,
+	FragmentDependencies: MergeDeep,
+	FragmentSteps:        MergeAppend,
+	FragmentMetadata:     MergeDeep,
+	FragmentOwner:        MergeReplace,
+}
+
+// LoadInsertions reads the places generated fragments are inserted at from the given file.
+func LoadInsertions(path string) ([]models.Insertion, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var i models.Insertions
+	err = yaml.Unmarshal(data, &i)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read insertions file %s: %w", path, err)
+	}
+	for n := range i.Insertions {
+		if err := checkInsertion(&i.Insertions[n]); err != nil {
+			return nil, fmt.Errorf("invalid insertion %d in %s: %w", n, path, err)
+		}
+	}
+	return i.Insertions, nil
+}
+
+// checkInsertion validates the insertion and sets its default merge.
+func checkInsertion(i *models.Insertion) error {
+	merge, ok := defaultMerge[i.Fragment]
+	if !ok {
+		return fmt.Errorf("unknown fragment %q, supported fragments are %s", i.Fragment, strings.Join(sortedKeys(defaultMerge), ", "))
+	}
+	switch i.Merge {
+	case "":
+		i.Merge = merge
+	case MergeDeep, MergeReplace, MergeAppend, MergePrepend:
+	default:
+		return fmt.Errorf("unknown merge %q for fragment %s", i.Merge, i.Fragment)
+	}
+	if i.Path == "" {
+		return fmt.Errorf("path of fragment %s must not be empty", i.Fragment)
+	}
+	if _, err := gojq.Parse(i.Path); err != nil {
+		return fmt.Errorf("invalid path of fragment %s: %w", i.Fragment, err)
+	}
+	return nil
+}
+
+// insertionExpression returns the jq expression inserting the value at the path of the insertion.
+func insertionExpression(i models.Insertion, value any) (string, error) {
+	if i.Merge == MergeAppend || i.Merge == MergePrepend {
+		if s := toSlice(value); s != nil {
+			value = s
+		} else {
+			value = []any{value}
+		}
+	}
+	v, err := jsonFromObject(value)
+	if err != nil {
+		return "", err
+	}
+	p := i.Path
+	switch i.Merge {
+	case MergeReplace:
+		return fmt.Sprintf("%s = %s", p, v), nil
+	case MergeAppend:
+		return fmt.Sprintf("%s = ((%s // []) + (%s - (%s // [])))", p, p, v, p), nil
+	case MergePrepend:
+		return fmt.Sprintf("%s = ((%s - (%s // [])) + (%s // []))", p, v, p, p), nil
+	default:
+		// objects are merged, anything else is replaced
+		if strings.HasPrefix(string(v), "{") {
+			return fmt.Sprintf("%s = ((%s // {}) * %s)", p, p, v), nil
+		}
+		return fmt.Sprintf("%s = %s", p, v), nil
+	}
+}
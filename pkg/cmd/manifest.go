@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// ManifestFile lists the files generated last, relative to the output directory. Files listed there that are not
+// generated anymore are pruned.
+const ManifestFile = ".cnoe/manifest.yaml"
+
+type manifest struct {
+	Files []string `yaml:"files"`
+}
+
+func readManifest(path string) (manifest, error) {
+	var m manifest
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return m, err
+	}
+	err = yamlv3.Unmarshal(data, &m)
+	return m, err
+}
+
+// prune records the generated files in the manifest on every run. When pruning, the files of the previous manifest
+// that were not generated this time are removed together with their merge base. Otherwise they stay listed, so that
+// a later run with pruning removes them. Nothing is removed when some definitions failed since their files were not
+// generated either. In dry-run mode the files are reported instead and the manifest is left as is.
+func (w *outputWriter) prune(complete bool) error {
+	if w.dryRun && !w.pruneFiles {
+		return nil
+	}
+	path := filepath.Join(w.root, ManifestFile)
+	previous, err := readManifest(path)
+	if err != nil {
+		return err
+	}
+
+	files := make(map[string]bool, len(w.written))
+	for f := range w.written {
+		rel, err := filepath.Rel(w.root, f)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = true
+	}
+	for _, rel := range previous.Files {
+		if files[rel] {
+			continue
+		}
+		// never remove files outside of the output directory
+		clean := filepath.Clean(filepath.FromSlash(rel))
+		if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if !w.pruneFiles {
+			files[rel] = true
+			continue
+		}
+		if !complete {
+			log.Printf("keeping %s since not all definitions were processed", rel)
+			files[rel] = true
+			continue
+		}
+		f := filepath.Join(w.root, filepath.FromSlash(rel))
+		if w.dryRun {
+			w.remove(f)
+			continue
+		}
+		log.Printf("removing %s since it is not generated anymore", rel)
+		for _, p := range []string{f, w.basePath(f)} {
+			if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+	}
+	if w.dryRun {
+		return nil
+	}
+
+	if len(files) == 0 && len(previous.Files) == 0 {
+		return nil
+	}
+	m := manifest{Files: make([]string, 0, len(files))}
+	for f := range files {
+		m.Files = append(m.Files, f)
+	}
+	sort.Strings(m.Files)
+	if err := checkAndCreateDir(filepath.Dir(path)); err != nil {
+		return err
+	}
+	return writeOutput(m, path)
+}
@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// MergeBaseDir holds copies of the files generated last, relative to the output directory. They are the common base
+// of the three-way merge of hand edits and newly generated content.
+const MergeBaseDir = ".cnoe/base"
+
+// ErrMergeConflict is returned when hand edits and newly generated content change the same value.
+var ErrMergeConflict = errors.New("generated files conflict with hand edits")
+
+// missing marks values that are not present in a document.
+var missing = &struct{}{}
+
+// mergeConflict is a value changed both by hand and by the generator.
+type mergeConflict struct {
+	path   string
+	ours   any
+	theirs any
+}
+
+func (c mergeConflict) String() string {
+	return fmt.Sprintf("! %s: %s <> %s", c.path, diffValue(conflictValue(c.ours)), diffValue(conflictValue(c.theirs)))
+}
+
+func conflictValue(v any) any {
+	if v == missing {
+		return nil
+	}
+	return v
+}
+
+// mergeGenerated merges the generated content into the file at path. Values edited by hand since the last generation
+// are kept, values changed by the generator are updated. The file is returned unchanged together with the conflicts
+// when both changed the same value. Base is nil for files that were not generated with merging before.
+func mergeGenerated(content any, existing, base []byte) (any, []mergeConflict, error) {
+	theirs, err := decodeOutput(content)
+	if err != nil {
+		return nil, nil, err
+	}
+	var ours any
+	if err := yamlv3.Unmarshal(existing, &ours); err != nil {
+		return nil, nil, fmt.Errorf("failed to read edited file: %w", err)
+	}
+	var b any = missing
+	if base != nil {
+		if err := yamlv3.Unmarshal(base, &b); err != nil {
+			return nil, nil, fmt.Errorf("failed to read merge base: %w", err)
+		}
+	}
+
+	conflicts := make([]mergeConflict, 0)
+	merged := mergeValues("", b, ours, theirs, &conflicts)
+	if len(conflicts) > 0 {
+		return ours, conflicts, nil
+	}
+	return merged, nil, nil
+}
+
+// mergeValues merges the values at path. Objects are merged by key, any other values including lists are replaced
+// as a whole.
+func mergeValues(path string, base, ours, theirs any, conflicts *[]mergeConflict) any {
+	switch {
+	case reflect.DeepEqual(ours, theirs):
+		return ours
+	case reflect.DeepEqual(base, ours):
+		return theirs
+	case reflect.DeepEqual(base, theirs):
+		return ours
+	}
+
+	o, oursIsMap := ours.(map[string]any)
+	t, theirsIsMap := theirs.(map[string]any)
+	b, baseIsMap := base.(map[string]any)
+	if !oursIsMap || !theirsIsMap || (!baseIsMap && base != missing) {
+		if path == "" {
+			path = "."
+		}
+		*conflicts = append(*conflicts, mergeConflict{path: path, ours: ours, theirs: theirs})
+		return ours
+	}
+
+	keys := make(map[string]any, len(o)+len(t))
+	for k := range o {
+		keys[k] = nil
+	}
+	for k := range t {
+		keys[k] = nil
+	}
+	for k := range b {
+		keys[k] = nil
+	}
+	out := make(map[string]any, len(keys))
+	for _, k := range sortedKeys(keys) {
+		v := mergeValues(fmt.Sprintf("%s.%s", path, k), valueOf(b, k), valueOf(o, k), valueOf(t, k), conflicts)
+		if v != missing {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+func valueOf(m map[string]any, key string) any {
+	if v, ok := m[key]; ok {
+		return v
+	}
+	return missing
+}
+
+// decodeOutput returns the generated content as it is read back from the written file.
+func decodeOutput(content any) (any, error) {
+	data, err := encodeOutput(content)
+	if err != nil {
+		return nil, err
+	}
+	var out any
+	if err := yamlv3.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// basePath returns where the merge base of the generated file at path is kept.
+func (w *outputWriter) basePath(path string) string {
+	rel, err := filepath.Rel(w.root, path)
+	if err != nil {
+		rel = filepath.Base(path)
+	}
+	return filepath.Join(w.root, MergeBaseDir, rel)
+}
+
+// merge merges the generated content into the existing file at path. It returns false when the file conflicts
+// with the generated content and must be left as it is.
+func (w *outputWriter) merge(content any, path string) (any, bool, error) {
+	existing, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		// files removed by hand are generated again
+		return content, true, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	base, err := os.ReadFile(w.basePath(path))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, false, err
+	}
+
+	merged, conflicts, err := mergeGenerated(content, existing, base)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to merge %s: %w", path, err)
+	}
+	if len(conflicts) > 0 {
+		w.conflicts[path] = conflicts
+		return nil, false, nil
+	}
+	return merged, true, nil
+}
+
+// writeBase records the generated content as the base of the next merge.
+func (w *outputWriter) writeBase(content any, path string) error {
+	base := w.basePath(path)
+	if err := checkAndCreateDir(filepath.Dir(base)); err != nil {
+		return err
+	}
+	return writeOutput(content, base)
+}
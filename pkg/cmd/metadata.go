@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+const (
+	// maxEntityNameLength is the longest metadata.name Backstage accepts.
+	maxEntityNameLength = 63
+
+	defaultTemplateName  = "{{.Name}}"
+	defaultTemplateTitle = "{{.Title}}"
+)
+
+var invalidEntityNameChars = regexp.MustCompile(`[^a-z0-9A-Z_.-]+`)
+
+// templateValues are available to the template metadata flags, e.g. --templateName '{{.Kind}}-template'.
+type templateValues struct {
+	// Name is the name of the generated file without extension.
+	Name string
+	// Title is a human readable name: the kind of a resource or the name of a module.
+	Title   string
+	Group   string
+	Version string
+	Kind    string
+	Module  string
+	// Description is taken from the definition, e.g. the README of a module.
+	Description string
+}
+
+// templateMetadata returns the metadata fields and the owner to set on a generated template. Name and title are
+// derived from the values when derive is set and no override is given, so every generated template is unique. The
+// description falls back to the description of the definition.
+func (c EntityConfig) templateMetadata(v templateValues, derive bool) (map[string]any, string, error) {
+	name, title := c.TemplateName, c.TemplateTitle
+	if derive {
+		if name == "" {
+			name = defaultTemplateName
+		}
+		if title == "" {
+			title = defaultTemplateTitle
+		}
+	}
+
+	metadata := make(map[string]any)
+	fields := []struct {
+		key, value string
+	}{
+		{"name", name},
+		{"title", title},
+		{"description", c.TemplateDescription},
+	}
+	for _, f := range fields {
+		if f.value == "" {
+			continue
+		}
+		s, err := renderTemplateValue(f.key, f.value, v)
+		if err != nil {
+			return nil, "", err
+		}
+		if f.key == "name" {
+			s = entityName(s)
+		}
+		metadata[f.key] = s
+	}
+	if _, ok := metadata["description"]; !ok && derive && v.Description != "" {
+		metadata["description"] = v.Description
+	}
+
+	if len(c.TemplateTags) > 0 {
+		tags := make([]any, 0, len(c.TemplateTags))
+		for _, t := range c.TemplateTags {
+			s, err := renderTemplateValue("tags", t, v)
+			if err != nil {
+				return nil, "", err
+			}
+			tags = append(tags, strings.ToLower(entityName(s)))
+		}
+		metadata["tags"] = tags
+	}
+
+	var owner string
+	if c.TemplateOwner != "" {
+		s, err := renderTemplateValue("owner", c.TemplateOwner, v)
+		if err != nil {
+			return nil, "", err
+		}
+		owner = s
+	}
+	return metadata, owner, nil
+}
+
+func renderTemplateValue(key, text string, v templateValues) (string, error) {
+	t, err := template.New(key).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid template %s %q: %w", key, text, err)
+	}
+	var sb strings.Builder
+	if err := t.Execute(&sb, v); err != nil {
+		return "", fmt.Errorf("failed to render template %s %q: %w", key, text, err)
+	}
+	return sb.String(), nil
+}
+
+// entityName turns s into a valid Backstage entity name by replacing unsupported characters and trimming it to the
+// maximum length.
+func entityName(s string) string {
+	s = invalidEntityNameChars.ReplaceAllString(s, "-")
+	if len(s) > maxEntityNameLength {
+		s = s[:maxEntityNameLength]
+	}
+	return strings.Trim(s, "-_.")
+}
@@ -0,0 +1,282 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	openAPISchemas []string
+
+	openAPICmd = &cobra.Command{
+		Use:   "openapi",
+		Short: "Generate backstage templates from OpenAPI specs and JSON Schemas",
+		Long: "Generate backstage templates from the component schemas of OpenAPI 3 specs (definitions of Swagger 2 specs) " +
+			"or from JSON Schema documents. The input directory may also be a single spec file.\n" +
+			"Local $refs are resolved, one output file is created per schema.",
+		PreRunE:      openAPIPreRunE,
+		RunE:         openAPI,
+		SilenceUsage: true,
+	}
+)
+
+func init() {
+	templateCmd.AddCommand(openAPICmd)
+	openAPICmd.Flags().StringSliceVarP(&openAPISchemas, "schemas", "", []string{}, "names of the component schemas to generate templates for, defaults to all of them")
+}
+
+// openAPIPreRunE allows the input to be a single spec file.
+func openAPIPreRunE(cmd *cobra.Command, args []string) error {
+	if info, err := os.Stat(inputDir); err == nil && !info.IsDir() {
+		return checkTemplateFlags()
+	}
+	return templatePreRunE(cmd, args)
+}
+
+func openAPI(cmd *cobra.Command, args []string) error {
+	m := NewOpenAPISpec(inputDir, outputDir, templatePath, insertionPoint, collapsed, raw)
+	m.Schemas = openAPISchemas
+	if err := applyTemplateFlags(&m.EntityConfig); err != nil {
+		return err
+	}
+	return Process(cmd.Context(), m)
+}
+
+type OpenAPISpec struct {
+	EntityConfig
+
+	// Schemas are the names of the component schemas to render. All schemas are rendered when empty.
+	Schemas []string
+}
+
+func NewOpenAPISpec(inputDir, outputDir, templatePath, insertionPoint string, collapsed, raw bool) *OpenAPISpec {
+	return &OpenAPISpec{
+		EntityConfig: EntityConfig{
+			InputDir:       inputDir,
+			OutputDir:      outputDir,
+			TemplateFile:   templatePath,
+			InsertionPoint: insertionPoint,
+			Collapsed:      collapsed,
+			Raw:            raw,
+		},
+	}
+}
+
+func (o *OpenAPISpec) Config() EntityConfig {
+	return o.EntityConfig
+}
+
+func (o *OpenAPISpec) GetDefinitions(ctx context.Context, inputDir string, currentDepth uint32) ([]string, error) {
+	if currentDepth > depth {
+		return nil, nil
+	}
+	if !isDirectory(inputDir) {
+		return []string{inputDir}, nil
+	}
+	out, err := getRelevantFiles(ctx, inputDir, currentDepth, o.findSpecs)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (o *OpenAPISpec) findSpecs(ctx context.Context, file os.DirEntry, currentDepth uint32, base string) ([]string, error) {
+	f := filepath.Join(base, file.Name())
+	if file.IsDir() {
+		return o.GetDefinitions(ctx, f, currentDepth+1)
+	}
+	if isOverlayFile(f) {
+		return nil, nil
+	}
+	switch filepath.Ext(f) {
+	case ".yaml", ".yml", ".json":
+		return []string{f}, nil
+	}
+	return nil, nil
+}
+
+// specSchema is a schema of a spec to render.
+type specSchema struct {
+	name   string
+	schema map[string]any
+}
+
+func (o *OpenAPISpec) HandleEntry(ctx context.Context, def, expectedOutDir, templateFile string) ([]EntityOutput, error) {
+	log.Printf("processing spec at %s", def)
+	data, err := os.ReadFile(def)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]any
+	err = yaml.Unmarshal(data, &doc)
+	if err != nil {
+		log.Printf("failed to read %s. This file will be excluded. %s", def, err)
+		return nil, nil
+	}
+
+	schemas, info := o.specSchemas(def, doc)
+	if len(schemas) == 0 {
+		log.Printf("%s does not contain any schemas to render", def)
+		return nil, nil
+	}
+
+	var hints uiRules
+	if o.UIRules != nil {
+		hints, err = o.uiHints()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	outputs := make([]EntityOutput, 0, len(schemas))
+	for _, s := range schemas {
+		schema, changes := normalizeSchema(doc, s.schema)
+		for i := range changes {
+			log.Printf("normalized %s %s", s.name, changes[i])
+		}
+		if o.UIRules != nil {
+			schema = hints.applyUIHints(s.name, schema)
+		}
+		v := templateValues{
+			Name:        strings.ToLower(s.name),
+			Title:       s.name,
+			Kind:        s.name,
+			Version:     stringValue(info["version"]),
+			Description: stringValue(schema["description"]),
+		}
+		if title := stringValue(schema["title"]); title != "" {
+			v.Title = title
+		}
+		if v.Description == "" {
+			v.Description = stringValue(info["description"])
+		}
+
+		content, err := o.createContent(ctx, v, templateFile, schema)
+		if err != nil {
+			log.Printf("failed to write %s: %s \n", def, err.Error())
+			return nil, err
+		}
+		outputs = append(outputs, EntityOutput{
+			Content:    content,
+			FileName:   filepath.Join(expectedOutDir, fmt.Sprintf("%s.yaml", v.Name)),
+			Source:     def,
+			Definition: fmt.Sprintf("schema %s", s.name),
+		})
+	}
+	return outputs, nil
+}
+
+// specSchemas returns the selected schemas of the document and the info of the spec. OpenAPI 3 specs provide their
+// schemas as components, Swagger 2 specs as definitions. Other documents are read as a single JSON Schema.
+func (o *OpenAPISpec) specSchemas(def string, doc map[string]any) ([]specSchema, map[string]any) {
+	info, _ := doc["info"].(map[string]any)
+	var all map[string]any
+	switch {
+	case doc["openapi"] != nil:
+		components, _ := doc["components"].(map[string]any)
+		all, _ = components["schemas"].(map[string]any)
+	case doc["swagger"] != nil:
+		all, _ = doc["definitions"].(map[string]any)
+	case doc["$schema"] != nil, doc["properties"] != nil:
+		name := stringValue(doc["title"])
+		if name == "" {
+			name = strings.TrimSuffix(filepath.Base(def), filepath.Ext(def))
+		}
+		all = map[string]any{name: doc}
+	}
+
+	out := make([]specSchema, 0, len(all))
+	for _, name := range sortedKeys(all) {
+		if len(o.Schemas) > 0 && !contains(o.Schemas, name) {
+			continue
+		}
+		s, ok := all[name].(map[string]any)
+		if !ok {
+			continue
+		}
+		out = append(out, specSchema{name: name, schema: s})
+	}
+	return out, info
+}
+
+func (o *OpenAPISpec) createContent(ctx context.Context, v templateValues, templateFile string, schema map[string]any) (any, error) {
+	props, ok := schema["properties"].(map[string]any)
+	if !ok {
+		// schemas that are not objects are asked for as a single field
+		props = map[string]any{v.Name: schema}
+	}
+	required := make([]string, 0)
+	for _, r := range toSlice(schema["required"]) {
+		if s, ok := r.(string); ok {
+			required = append(required, s)
+		}
+	}
+	if shouldCreateCollapsedTemplate(o) {
+		props = withResourceEnum(props, v.Name)
+	}
+
+	if !shouldCreateNonCollapsedTemplate(o) {
+		return map[string]any{
+			"properties": props,
+			"required":   required,
+		}, nil
+	}
+	if o.Steps != "" {
+		return nil, errors.New("steps are not supported for OpenAPI schemas")
+	}
+
+	input := insertAtInput{
+		templatePath:     templateFile,
+		jqPathExpression: o.InsertionPoint,
+		fields: map[string]any{
+			"properties": props,
+		},
+		insertions: o.Insertions,
+	}
+	if len(required) > 0 {
+		input.required = required
+	}
+	var err error
+	input.metadata, input.owner, err = o.templateMetadata(v, true)
+	if err != nil {
+		return nil, err
+	}
+	if o.SplitBy != "" {
+		first, rest, err := splitPages(o.SplitBy, o.Pages, props, required)
+		if err != nil {
+			return nil, err
+		}
+		input.fields["properties"] = first.properties
+		input.required = first.required
+		for _, p := range rest {
+			input.pages = append(input.pages, p.toParameters(p.properties, p.required))
+		}
+	}
+	return insertAt(ctx, input)
+}
+
+// withResourceEnum adds the field the collapsed template selects the resource with.
+func withResourceEnum(props map[string]any, name string) map[string]any {
+	out := make(map[string]any, len(props)+1)
+	for k, v := range props {
+		out[k] = v
+	}
+	if _, ok := out["resources"]; ok {
+		log.Printf("the resources field of %s is replaced by the resource selection of the collapsed template", name)
+	}
+	out["resources"] = map[string]any{"enum": []any{name}}
+	return out
+}
+
+func stringValue(v any) string {
+	s, _ := v.(string)
+	return s
+}
@@ -0,0 +1,109 @@
+package cmd_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/cnoe-io/cnoe-cli/pkg/cmd"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("OpenAPI Template", func() {
+	var (
+		tempDir   string
+		outputDir string
+
+		stdout *gbytes.Buffer
+	)
+
+	const (
+		inputDir             = "./fakes/openapi/input"
+		specFile             = "./fakes/openapi/input/prerequisites.yaml"
+		validOutputDir       = "./fakes/openapi/output"
+		targetTemplateFile   = "./fakes/template/input-template.yaml"
+		expectedTemplateFile = "./fakes/openapi/output/full-template-prerequisite.yaml"
+	)
+
+	BeforeEach(func() {
+		var err error
+		tempDir, err = os.MkdirTemp("", "test-temp")
+		Expect(err).NotTo(HaveOccurred())
+
+		outputDir = filepath.Join(tempDir, "output")
+		err = os.Mkdir(outputDir, 0755)
+		Expect(err).NotTo(HaveOccurred())
+
+		stdout = gbytes.NewBuffer()
+		log.SetOutput(stdout)
+	})
+
+	AfterEach(func() {
+		err := os.RemoveAll(tempDir)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	Context("with selected schemas and no target template specified", func() {
+		BeforeEach(func() {
+			spec := cmd.NewOpenAPISpec(inputDir, outputDir, "", "", false, true)
+			spec.Schemas = []string{"Prerequisite", "Bucket"}
+			Expect(cmd.Process(context.Background(), spec)).To(Succeed())
+		})
+
+		It("should create properties with resolved references for every selected schema", func() {
+			files, err := readOutputDir(outputDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(files).To(HaveLen(2))
+
+			for i := range files {
+				generatedData, err := os.ReadFile(filepath.Join(outputDir, files[i].Name()))
+				Expect(err).NotTo(HaveOccurred())
+				expectedData, err := os.ReadFile(filepath.Join(validOutputDir, fmt.Sprintf("properties-%s", files[i].Name())))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(generatedData).To(MatchYAML(expectedData))
+			}
+		})
+	})
+
+	Context("with a spec file and a target template specified", func() {
+		It("should create the template file with the schema merged", func() {
+			spec := cmd.NewOpenAPISpec(specFile, outputDir, targetTemplateFile, ".spec.parameters[0]", false, false)
+			spec.Schemas = []string{"Prerequisite"}
+			Expect(cmd.Process(context.Background(), spec)).To(Succeed())
+
+			generatedData, err := os.ReadFile(filepath.Join(outputDir, "prerequisite.yaml"))
+			Expect(err).NotTo(HaveOccurred())
+			expectedData, err := os.ReadFile(expectedTemplateFile)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(generatedData).To(MatchYAML(expectedData))
+		})
+
+		It("should render every component schema by default", func() {
+			spec := cmd.NewOpenAPISpec(specFile, outputDir, "", "", false, true)
+			Expect(cmd.Process(context.Background(), spec)).To(Succeed())
+
+			files, err := readOutputDir(outputDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(files).To(HaveLen(6))
+		})
+
+		It("should record the file as the source in the index", func() {
+			spec := cmd.NewOpenAPISpec(specFile, outputDir, "", "", false, true)
+			spec.Schemas = []string{"Prerequisite"}
+			spec.Index = true
+			Expect(cmd.Process(context.Background(), spec)).To(Succeed())
+
+			index, err := os.ReadFile(filepath.Join(outputDir, cmd.IndexFile))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(index).To(MatchYAML(`templates:
+  - file: prerequisite.yaml
+    source: prerequisites.yaml
+    definition: schema Prerequisite
+`))
+		})
+	})
+})
@@ -0,0 +1,318 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	changeCreate   = "create"
+	changeUpdate   = "change"
+	changeRemove   = "remove"
+	changeConflict = "conflict"
+
+	untrackedFile = "untracked"
+)
+
+// ErrOutputChanged is returned in dry-run and diff mode when the generated files differ from the output directory.
+var ErrOutputChanged = errors.New("generated files differ from the output directory")
+
+// fileChange is a change to the output directory found in dry-run mode.
+type fileChange struct {
+	action string
+	path   string
+	diff   []string
+}
+
+// outputWriter writes the generated files. In dry-run mode files are compared with the output directory instead of
+// being written, and the changes are reported at the end. In merge mode hand edits of existing files are kept.
+// Files generated before but not anymore are removed when pruning. Without pruning, yaml files in the output
+// directory that were not generated are reported as untracked, since they may not have been generated by us.
+type outputWriter struct {
+	dryRun     bool
+	diff       bool
+	mergeEdits bool
+	pruneFiles bool
+	root       string
+	out        io.Writer
+
+	written   map[string]bool
+	removed   map[string]bool
+	changes   []fileChange
+	untracked []string
+	conflicts map[string][]mergeConflict
+}
+
+func newOutputWriter(c EntityConfig, root string) *outputWriter {
+	out := c.Out
+	if out == nil {
+		out = os.Stdout
+	}
+	return &outputWriter{
+		dryRun:     c.DryRun || c.Diff,
+		diff:       c.Diff,
+		mergeEdits: c.Merge,
+		pruneFiles: c.Prune,
+		root:       root,
+		out:        out,
+		written:    make(map[string]bool),
+		removed:    make(map[string]bool),
+		conflicts:  make(map[string][]mergeConflict),
+	}
+}
+
+// write writes the content to path, or records how it would change in dry-run mode. The file is only tracked once
+// it is written or its change is recorded, so files that failed are neither listed in the manifest nor hidden from
+// the untracked files.
+func (w *outputWriter) write(content any, path string) error {
+	generated := content
+	if w.mergeEdits {
+		merged, ok, err := w.merge(content, path)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			if w.dryRun {
+				w.changes = append(w.changes, fileChange{action: changeConflict, path: path, diff: conflictLines(w.conflicts[path])})
+			}
+			w.written[path] = true
+			return nil
+		}
+		content = merged
+	}
+	if !w.dryRun {
+		if err := writeOutput(content, path); err != nil {
+			return err
+		}
+		w.written[path] = true
+		if w.mergeEdits {
+			return w.writeBase(generated, path)
+		}
+		return nil
+	}
+
+	data, err := encodeOutput(content)
+	if err != nil {
+		return err
+	}
+	existing, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		w.changes = append(w.changes, fileChange{action: changeCreate, path: path})
+		w.written[path] = true
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	lines, err := semanticDiff(existing, data)
+	if err != nil {
+		return fmt.Errorf("failed to compare %s: %w", path, err)
+	}
+	if len(lines) > 0 {
+		w.changes = append(w.changes, fileChange{action: changeUpdate, path: path, diff: lines})
+	}
+	w.written[path] = true
+	return nil
+}
+
+// findUntracked records the yaml files in the given directories that were not generated. They are not changes, since
+// only files listed in the manifest are removed when pruning.
+func (w *outputWriter) findUntracked(dirs ...string) error {
+	if !w.dryRun || w.pruneFiles {
+		return nil
+	}
+	seen := make(map[string]bool)
+	for _, dir := range dirs {
+		if seen[dir] {
+			continue
+		}
+		seen[dir] = true
+		files, err := os.ReadDir(dir)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			path := filepath.Join(dir, f.Name())
+			if f.IsDir() || filepath.Ext(f.Name()) != ".yaml" || w.written[path] {
+				continue
+			}
+			w.untracked = append(w.untracked, path)
+		}
+	}
+	return nil
+}
+
+// remove records a file that would be removed in dry-run mode.
+func (w *outputWriter) remove(path string) {
+	if w.removed[path] {
+		return
+	}
+	w.removed[path] = true
+	w.changes = append(w.changes, fileChange{action: changeRemove, path: path})
+}
+
+// report prints the changes and untracked files found in dry-run mode and returns ErrOutputChanged if there are
+// changes. Otherwise it logs the merge conflicts and returns ErrMergeConflict if there are any.
+func (w *outputWriter) report() error {
+	if !w.dryRun {
+		return w.reportConflicts()
+	}
+	sort.SliceStable(w.changes, func(i, j int) bool {
+		return w.changes[i].path < w.changes[j].path
+	})
+	for _, c := range w.changes {
+		fmt.Fprintf(w.out, "%-7s %s\n", c.action, w.relative(c.path))
+		if w.diff {
+			for _, l := range c.diff {
+				fmt.Fprintf(w.out, "    %s\n", l)
+			}
+		}
+	}
+	sort.Strings(w.untracked)
+	for _, path := range w.untracked {
+		fmt.Fprintf(w.out, "%s %s\n", untrackedFile, w.relative(path))
+	}
+	if len(w.changes) == 0 {
+		fmt.Fprintln(w.out, "no changes")
+		return nil
+	}
+	return ErrOutputChanged
+}
+
+// relative returns the path relative to the output root for reporting.
+func (w *outputWriter) relative(path string) string {
+	rel, err := filepath.Rel(w.root, path)
+	if err != nil {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
+
+func (w *outputWriter) reportConflicts() error {
+	if len(w.conflicts) == 0 {
+		return nil
+	}
+	files := make([]string, 0, len(w.conflicts))
+	for _, path := range sortedKeys(w.conflicts) {
+		rel := w.relative(path)
+		for _, c := range w.conflicts[path] {
+			log.Printf("%s was left unchanged since a value was edited and generated differently: %s", rel, c)
+		}
+		files = append(files, rel)
+	}
+	return fmt.Errorf("%w: %s", ErrMergeConflict, strings.Join(files, ", "))
+}
+
+func conflictLines(conflicts []mergeConflict) []string {
+	out := make([]string, 0, len(conflicts))
+	for _, c := range conflicts {
+		out = append(out, c.String())
+	}
+	return out
+}
+
+func encodeOutput(content any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yamlv3.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(content); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// semanticDiff compares two yaml documents by their values, ignoring formatting and key order. Each line is a
+// change prefixed with + (added), - (removed) or ~ (changed).
+func semanticDiff(old, new []byte) ([]string, error) {
+	var o, n any
+	if err := yaml.Unmarshal(old, &o); err != nil {
+		// files that are not yaml anymore are replaced entirely
+		return []string{"~ .: not a yaml document"}, nil
+	}
+	if err := yaml.Unmarshal(new, &n); err != nil {
+		return nil, err
+	}
+	lines := make([]string, 0)
+	diffValues("", o, n, &lines)
+	return lines, nil
+}
+
+func diffValues(path string, old, new any, lines *[]string) {
+	switch o := old.(type) {
+	case map[string]any:
+		n, ok := new.(map[string]any)
+		if !ok {
+			break
+		}
+		keys := make(map[string]any, len(o)+len(n))
+		for k := range o {
+			keys[k] = nil
+		}
+		for k := range n {
+			keys[k] = nil
+		}
+		for _, k := range sortedKeys(keys) {
+			ov, inOld := o[k]
+			nv, inNew := n[k]
+			p := fmt.Sprintf("%s.%s", path, k)
+			switch {
+			case !inOld:
+				*lines = append(*lines, fmt.Sprintf("+ %s: %s", p, diffValue(nv)))
+			case !inNew:
+				*lines = append(*lines, fmt.Sprintf("- %s: %s", p, diffValue(ov)))
+			default:
+				diffValues(p, ov, nv, lines)
+			}
+		}
+		return
+	case []any:
+		n, ok := new.([]any)
+		if !ok {
+			break
+		}
+		for i := 0; i < len(o) || i < len(n); i++ {
+			p := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(o):
+				*lines = append(*lines, fmt.Sprintf("+ %s: %s", p, diffValue(n[i])))
+			case i >= len(n):
+				*lines = append(*lines, fmt.Sprintf("- %s: %s", p, diffValue(o[i])))
+			default:
+				diffValues(p, o[i], n[i], lines)
+			}
+		}
+		return
+	}
+	if !reflect.DeepEqual(old, new) {
+		if path == "" {
+			path = "."
+		}
+		*lines = append(*lines, fmt.Sprintf("~ %s: %s -> %s", path, diffValue(old), diffValue(new)))
+	}
+}
+
+func diffValue(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return strings.TrimSpace(string(b))
+}
@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/itchyny/gojq"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// OverlayAll names the overlays applied to every generated template.
+	OverlayAll = "_all"
+
+	overlayMerge = "merge"
+	overlayPatch = "patch"
+	overlayJQ    = "jq"
+)
+
+// overlayFiles lists the overlay files of an output in the order they are applied. JSON Merge Patches are applied
+// first, JSON Patches next and jq expressions last.
+var overlayFiles = []struct {
+	kind   string
+	suffix string
+}{
+	{overlayMerge, ".merge.yaml"},
+	{overlayMerge, ".merge.json"},
+	{overlayPatch, ".patch.yaml"},
+	{overlayPatch, ".patch.json"},
+	{overlayJQ, ".jq"},
+}
+
+// isOverlayFile returns true for files holding overlays rather than definitions.
+func isOverlayFile(name string) bool {
+	for _, f := range overlayFiles {
+		if strings.HasSuffix(name, f.suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// overlayDirs returns the directories searched for overlays of outputs generated from source: OverlayDir and the
+// directory of the source.
+func (c EntityConfig) overlayDirs(source string) []string {
+	dirs := make([]string, 0, 2)
+	if c.OverlayDir != "" {
+		dirs = append(dirs, c.OverlayDir)
+	}
+	if info, err := os.Stat(source); err == nil {
+		if !info.IsDir() {
+			source = filepath.Dir(source)
+		}
+		if len(dirs) == 0 || !sameDir(dirs[0], source) {
+			dirs = append(dirs, source)
+		}
+	}
+	return dirs
+}
+
+func sameDir(a, b string) bool {
+	a, errA := filepath.Abs(a)
+	b, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && a == b
+}
+
+// applyOverlays applies the overlays found for each output to its content. Overlays for all templates are applied
+// before the overlays named after the output file, e.g. bucket.merge.yaml for bucket.yaml. Sidecar outputs only get
+// the overlays named after them, and so do the parts of a collapsed template. The overlays for all templates are
+// applied to the collapsed template itself.
+func applyOverlays(ctx context.Context, c EntityConfig, outputs []EntityOutput) error {
+	for i := range outputs {
+		out := &outputs[i]
+		names := []string{OverlayAll}
+		if out.Sidecar || (c.Collapsed && !c.Raw) {
+			names = nil
+		}
+		names = append(names, strings.TrimSuffix(filepath.Base(out.FileName), ".yaml"))
+		if err := applyNamedOverlays(ctx, c, out, names); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyNamedOverlays applies the overlays with the given names, in that order, to the content of the output.
+func applyNamedOverlays(ctx context.Context, c EntityConfig, out *EntityOutput, names []string) error {
+	if out.Content == nil {
+		return nil
+	}
+	content := out.Content
+	for _, dir := range c.overlayDirs(out.Source) {
+		for _, name := range names {
+			for _, f := range overlayFiles {
+				path := filepath.Join(dir, name+f.suffix)
+				data, err := os.ReadFile(path)
+				if errors.Is(err, os.ErrNotExist) {
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				log.Printf("applying %s to %s", path, out.FileName)
+				content, err = applyOverlay(ctx, f.kind, data, content)
+				if err != nil {
+					return fmt.Errorf("failed to apply %s to %s: %w", path, out.FileName, err)
+				}
+			}
+		}
+	}
+	out.Content = content
+	return nil
+}
+
+// applyOverlay applies a single overlay to the content and returns the result.
+func applyOverlay(ctx context.Context, kind string, overlay []byte, content any) (any, error) {
+	doc, err := jsonFromObject(content)
+	if err != nil {
+		return nil, err
+	}
+
+	switch kind {
+	case overlayMerge, overlayPatch:
+		patch, err := yaml.YAMLToJSON(overlay)
+		if err != nil {
+			return nil, err
+		}
+		if kind == overlayMerge {
+			doc, err = jsonpatch.MergePatch(doc, patch)
+		} else {
+			var p jsonpatch.Patch
+			p, err = jsonpatch.DecodePatch(patch)
+			if err == nil {
+				doc, err = p.Apply(doc)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		var out any
+		err = json.Unmarshal(doc, &out)
+		return out, err
+	default:
+		var in any
+		if err := json.Unmarshal(doc, &in); err != nil {
+			return nil, err
+		}
+		query, err := gojq.Parse(string(overlay))
+		if err != nil {
+			return nil, err
+		}
+		iter := query.RunWithContext(ctx, in)
+		v, ok := iter.Next()
+		if !ok {
+			return nil, errors.New("jq expression did not return a value")
+		}
+		if err, ok := v.(error); ok {
+			return nil, err
+		}
+		return v, nil
+	}
+}
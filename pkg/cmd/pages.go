@@ -0,0 +1,183 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/cnoe-io/cnoe-cli/pkg/models"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	SplitByGroup    = "group"
+	SplitByRequired = "required"
+	SplitByFile     = "file"
+
+	optionalPageTitle = "Optional settings"
+)
+
+// page is a group of generated properties rendered as a single step of the wizard.
+type page struct {
+	title       string
+	description string
+	properties  map[string]any
+	required    []string
+}
+
+func LoadPages(path string) ([]models.Page, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var p models.Pages
+	err = yaml.Unmarshal(data, &p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pages file %s: %w", path, err)
+	}
+	return p.Pages, nil
+}
+
+// splitPages splits properties according to the given mode. The first page holds the properties rendered at the
+// insertion point, the remaining pages are added as new steps after it.
+func splitPages(mode string, defs []models.Page, properties map[string]any, required []string) (page, []page, error) {
+	names := sortedKeys(properties)
+	first := page{properties: make(map[string]any)}
+	rest := make([]page, 0)
+
+	switch mode {
+	case SplitByGroup:
+		for _, name := range names {
+			if propertyType(properties[name]) != "object" {
+				first.properties[name] = properties[name]
+				continue
+			}
+			rest = append(rest, page{
+				title:      propertyTitle(name, properties[name]),
+				properties: map[string]any{name: properties[name]},
+			})
+		}
+	case SplitByRequired:
+		optional := page{title: optionalPageTitle, properties: make(map[string]any)}
+		for _, name := range names {
+			if contains(required, name) {
+				first.properties[name] = properties[name]
+			} else {
+				optional.properties[name] = properties[name]
+			}
+		}
+		if len(optional.properties) > 0 {
+			rest = append(rest, optional)
+		}
+	case SplitByFile:
+		assigned := make(map[string]bool)
+		for _, d := range defs {
+			p := page{title: d.Title, description: d.Description, properties: make(map[string]any)}
+			for _, name := range d.Properties {
+				if v, ok := properties[name]; ok && !assigned[name] {
+					p.properties[name] = v
+					assigned[name] = true
+				}
+			}
+			if len(p.properties) > 0 {
+				rest = append(rest, p)
+			}
+		}
+		for _, name := range names {
+			if !assigned[name] {
+				first.properties[name] = properties[name]
+			}
+		}
+	default:
+		return page{}, nil, fmt.Errorf("unsupported split mode %q. supported modes are %s, %s and %s", mode, SplitByGroup, SplitByRequired, SplitByFile)
+	}
+
+	first.required = requiredIn(first.properties, required)
+	for i := range rest {
+		rest[i].required = requiredIn(rest[i].properties, required)
+	}
+	return first, rest, nil
+}
+
+// toParameters returns the page as an entry of the template's spec.parameters.
+func (p page) toParameters(properties any, required []string) map[string]any {
+	out := map[string]any{
+		"title":      p.title,
+		"properties": properties,
+	}
+	if p.description != "" {
+		out["description"] = p.description
+	}
+	if len(required) > 0 {
+		out["required"] = required
+	}
+	return out
+}
+
+// trimOrder removes fields that are not on the page from ui:order, since Backstage rejects unknown fields in it.
+func trimOrder(schema map[string]any) map[string]any {
+	order := toSlice(schema[uiOrder])
+	if order == nil {
+		return schema
+	}
+	props, _ := schema["properties"].(map[string]any)
+	trimmed := make([]any, 0, len(order))
+	for _, o := range order {
+		if _, ok := props[fmt.Sprint(o)]; ok || o == "*" {
+			trimmed = append(trimmed, o)
+		}
+	}
+	schema[uiOrder] = trimmed
+	return schema
+}
+
+func requiredIn(properties map[string]any, required []string) []string {
+	out := make([]string, 0)
+	for _, r := range required {
+		if _, ok := properties[r]; ok {
+			out = append(out, r)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func propertyType(v any) string {
+	switch p := v.(type) {
+	case map[string]any:
+		if t, ok := p["type"].(string); ok {
+			return t
+		}
+		if _, ok := p["properties"]; ok {
+			return "object"
+		}
+	case models.BackstageParamFields:
+		return p.Type
+	case *models.BackstageParamFields:
+		return p.Type
+	}
+	return ""
+}
+
+func propertyTitle(name string, v any) string {
+	switch p := v.(type) {
+	case map[string]any:
+		if t, ok := p["title"].(string); ok && t != "" {
+			return t
+		}
+	case models.BackstageParamFields:
+		if p.Title != "" {
+			return p.Title
+		}
+	}
+	return name
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,339 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	extIntOrString      = "x-kubernetes-int-or-string"
+	extPreserveUnknown  = "x-kubernetes-preserve-unknown-fields"
+	extEmbeddedResource = "x-kubernetes-embedded-resource"
+	extPrefix           = "x-kubernetes-"
+
+	// intOrStringPattern accepts numbers as well as names and percentages for int-or-string fields without a pattern
+	intOrStringPattern = `^(\d+|[^\s]+)$`
+
+	// free-form objects are rendered as a multi-line text box where users can type YAML
+	freeFormWidget = "textarea"
+	freeFormRows   = 10
+)
+
+// schemaNormalizer rewrites OpenAPI constructs that react-jsonschema-form does not render well into equivalent forms
+// it understands. Every rewrite is recorded in changes.
+type schemaNormalizer struct {
+	root    map[string]any
+	changes []string
+}
+
+// normalizeSchema returns a normalized copy of schema together with a report of what was changed.
+// $refs are resolved against root.
+func normalizeSchema(root, schema map[string]any) (map[string]any, []string) {
+	n := &schemaNormalizer{root: root}
+	out := n.normalize("", schema, map[string]bool{})
+	return out, n.changes
+}
+
+func (n *schemaNormalizer) report(path, format string, args ...any) {
+	if path == "" {
+		path = "."
+	}
+	n.changes = append(n.changes, fmt.Sprintf("%s: %s", path, fmt.Sprintf(format, args...)))
+}
+
+func (n *schemaNormalizer) normalize(path string, schema map[string]any, refs map[string]bool) map[string]any {
+	node := make(map[string]any, len(schema))
+	for k, v := range schema {
+		node[k] = v
+	}
+
+	if ref, ok := node["$ref"].(string); ok {
+		delete(node, "$ref")
+		if refs[ref] {
+			n.report(path, "recursive $ref %s replaced with a free-form field", ref)
+			return n.freeForm(node)
+		}
+		target, err := n.resolve(ref)
+		if err != nil {
+			n.report(path, "could not resolve $ref: %s", err)
+		} else {
+			n.report(path, "resolved $ref %s", ref)
+			// keywords next to the $ref, e.g. a description, take precedence over the referenced schema
+			for k, v := range target {
+				if _, ok := node[k]; !ok {
+					node[k] = v
+				}
+			}
+			refs = withRef(refs, ref)
+			// the referenced schema may itself contain refs
+			return n.normalize(path, node, refs)
+		}
+	}
+
+	if allOf, ok := node["allOf"].([]any); ok {
+		delete(node, "allOf")
+		for i := range allOf {
+			sub, ok := allOf[i].(map[string]any)
+			if !ok {
+				continue
+			}
+			mergeSchema(node, n.normalize(path, sub, refs))
+		}
+		n.report(path, "merged %d allOf schemas", len(allOf))
+	}
+
+	if v, ok := node[extIntOrString].(bool); ok && v {
+		delete(node, "anyOf")
+		delete(node, "oneOf")
+		node["type"] = "string"
+		if _, ok := node["pattern"]; !ok {
+			node["pattern"] = intOrStringPattern
+		}
+		n.report(path, "%s converted to string", extIntOrString)
+	}
+
+	for _, key := range []string{"anyOf", "oneOf"} {
+		branches, ok := node[key].([]any)
+		if !ok {
+			continue
+		}
+		switch {
+		case onlyKeywords(branches, "required"):
+			// validation only, the form cannot express it
+			delete(node, key)
+			n.report(path, "removed validation only %s", key)
+		case onlyKeywords(branches, "type", "format"):
+			delete(node, key)
+			node["type"] = collapseTypes(branches)
+			n.report(path, "%s of primitive types converted to %s", key, node["type"])
+		default:
+			converted := make([]any, len(branches))
+			for i := range branches {
+				if b, ok := branches[i].(map[string]any); ok {
+					converted[i] = n.normalize(fmt.Sprintf("%s.%s[%d]", path, key, i), b, refs)
+				} else {
+					converted[i] = branches[i]
+				}
+			}
+			node[key] = converted
+		}
+	}
+
+	if v, ok := node[extEmbeddedResource].(bool); ok && v {
+		if _, ok := node["type"]; !ok {
+			node["type"] = "object"
+		}
+		n.report(path, "removed %s", extEmbeddedResource)
+		if _, ok := node["properties"]; !ok {
+			node[extPreserveUnknown] = true
+		}
+	}
+
+	if v, ok := node[extPreserveUnknown].(bool); ok && v {
+		if _, ok := node["properties"]; !ok {
+			n.report(path, "%s converted to a free-form YAML field", extPreserveUnknown)
+			node = n.freeForm(node)
+		} else {
+			n.report(path, "removed %s", extPreserveUnknown)
+		}
+	}
+
+	for _, k := range sortedKeys(node) {
+		if strings.HasPrefix(k, extPrefix) {
+			delete(node, k)
+			if k != extIntOrString && k != extPreserveUnknown && k != extEmbeddedResource {
+				n.report(path, "removed %s", k)
+			}
+		}
+	}
+
+	if props, ok := node["properties"].(map[string]any); ok {
+		converted := make(map[string]any, len(props))
+		for _, k := range sortedKeys(props) {
+			if p, ok := props[k].(map[string]any); ok {
+				converted[k] = n.normalize(joinPath(path, k), p, refs)
+			} else {
+				converted[k] = props[k]
+			}
+		}
+		node["properties"] = converted
+	}
+
+	if items, ok := node["items"].(map[string]any); ok {
+		node["items"] = n.normalize(path+"[]", items, refs)
+	}
+
+	if additional, ok := node["additionalProperties"].(map[string]any); ok {
+		node["additionalProperties"] = n.normalize(joinPath(path, "*"), additional, refs)
+	}
+
+	return node
+}
+
+// freeForm turns the node into a multi-line string field. Descriptive keywords are kept.
+func (n *schemaNormalizer) freeForm(node map[string]any) map[string]any {
+	out := map[string]any{
+		"type":      "string",
+		"ui:widget": freeFormWidget,
+		"ui:options": map[string]any{
+			"rows": int64(freeFormRows),
+		},
+	}
+	for _, k := range []string{"title", "description"} {
+		if v, ok := node[k]; ok {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// resolve looks up a local reference such as #/components/schemas/Spec in the root document.
+func (n *schemaNormalizer) resolve(ref string) (map[string]any, error) {
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("only local references are supported, got %s", ref)
+	}
+	var current any = n.root
+	for _, token := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		switch c := current.(type) {
+		case map[string]any:
+			v, ok := c[token]
+			if !ok {
+				return nil, fmt.Errorf("%s not found", ref)
+			}
+			current = v
+		case []any:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(c) {
+				return nil, fmt.Errorf("%s not found", ref)
+			}
+			current = c[i]
+		default:
+			return nil, fmt.Errorf("%s not found", ref)
+		}
+	}
+	target, ok := current.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a schema", ref)
+	}
+	return target, nil
+}
+
+// mergeSchema merges src into dst. Properties are merged, required fields are combined, and other keywords are only
+// set when dst does not define them.
+func mergeSchema(dst, src map[string]any) {
+	for k, v := range src {
+		switch k {
+		case "properties":
+			props, _ := dst["properties"].(map[string]any)
+			if props == nil {
+				props = make(map[string]any)
+			}
+			if srcProps, ok := v.(map[string]any); ok {
+				for pk, pv := range srcProps {
+					props[pk] = pv
+				}
+			}
+			dst["properties"] = props
+		case "required":
+			dst["required"] = appendUnique(toSlice(dst["required"]), toSlice(v)...)
+		default:
+			if _, ok := dst[k]; !ok {
+				dst[k] = v
+			}
+		}
+	}
+}
+
+// onlyKeywords reports whether every branch is a schema using nothing but the given keywords.
+func onlyKeywords(branches []any, keywords ...string) bool {
+	if len(branches) == 0 {
+		return false
+	}
+	allowed := make(map[string]bool, len(keywords))
+	for _, k := range keywords {
+		allowed[k] = true
+	}
+	for i := range branches {
+		b, ok := branches[i].(map[string]any)
+		if !ok || len(b) == 0 {
+			return false
+		}
+		for k := range b {
+			if !allowed[k] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// collapseTypes picks a single type able to hold values of all branches. Strings can hold anything.
+func collapseTypes(branches []any) string {
+	types := make([]string, 0, len(branches))
+	for i := range branches {
+		if t, ok := branches[i].(map[string]any)["type"].(string); ok {
+			types = append(types, t)
+		}
+	}
+	for _, t := range types {
+		if t == "string" {
+			return t
+		}
+	}
+	if len(types) == 0 {
+		return "string"
+	}
+	return types[0]
+}
+
+func withRef(refs map[string]bool, ref string) map[string]bool {
+	out := make(map[string]bool, len(refs)+1)
+	for k := range refs {
+		out[k] = true
+	}
+	out[ref] = true
+	return out
+}
+
+func joinPath(path, key string) string {
+	return fmt.Sprintf("%s.%s", path, key)
+}
+
+func toSlice(v any) []any {
+	switch s := v.(type) {
+	case []any:
+		return s
+	case []string:
+		return ConvertSlice(s)
+	default:
+		return nil
+	}
+}
+
+func appendUnique(dst []any, values ...any) []any {
+	for _, v := range values {
+		found := false
+		for _, d := range dst {
+			if d == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			dst = append(dst, v)
+		}
+	}
+	return dst
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
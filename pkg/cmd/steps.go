@@ -0,0 +1,292 @@
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	StepProfileK8sApply = "k8s-apply"
+	StepProfileGitHubPR = "github-pr"
+	StepProfileTFVarsPR = "tfvars-pr"
+
+	stepsPath = ".spec.steps"
+)
+
+var templateIdentifier = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+// stepInput describes the generated parameters the steps refer to.
+type stepInput struct {
+	name       string
+	namespaced bool
+	verifiers  bool
+	variables  []string
+	// secrets are the variables whose values are referenced from Kubernetes secrets instead of being written.
+	secrets []string
+	// configFields maps the fields of a configuration split into wizard pages to the parameters holding them.
+	configFields map[string]string
+}
+
+// stepProfile generates scaffolder steps together with the parameters they depend on, so they cannot drift apart.
+type stepProfile struct {
+	parameters map[string]any
+	required   []string
+	steps      func(stepInput) []any
+}
+
+var (
+	nameParameter = map[string]any{
+		"type":        "string",
+		"description": "name of this resource. This will be the name of K8s object.",
+	}
+	repoURLParameter = map[string]any{
+		"title":    "Repository Location",
+		"type":     "string",
+		"ui:field": "RepoUrlPicker",
+		"ui:options": map[string]any{
+			"allowedHosts": []any{"github.com"},
+		},
+	}
+
+	crdStepProfiles = map[string]stepProfile{
+		StepProfileK8sApply: {
+			parameters: map[string]any{
+				"name": nameParameter,
+			},
+			required: []string{"name"},
+			steps:    k8sApplySteps,
+		},
+		StepProfileGitHubPR: {
+			parameters: map[string]any{
+				"name": nameParameter,
+				"path": map[string]any{
+					"type":        "string",
+					"description": "path to place this file into",
+					"default":     "kustomize/base",
+				},
+				"repoUrl": repoURLParameter,
+			},
+			required: []string{"name", "repoUrl"},
+			steps:    gitHubPRSteps,
+		},
+	}
+
+	tfStepProfiles = map[string]stepProfile{
+		StepProfileTFVarsPR: {
+			parameters: map[string]any{
+				"path": map[string]any{
+					"type":        "string",
+					"description": "path to place the tfvars file into",
+					"default":     "terraform",
+				},
+				"repoUrl": repoURLParameter,
+			},
+			required: []string{"repoUrl"},
+			steps:    tfVarsPRSteps,
+		},
+	}
+)
+
+func lookupStepProfile(profiles map[string]stepProfile, name string) (stepProfile, error) {
+	p, ok := profiles[name]
+	if !ok {
+		supported := make([]string, 0, len(profiles))
+		for k := range profiles {
+			supported = append(supported, k)
+		}
+		sort.Strings(supported)
+		return stepProfile{}, fmt.Errorf("unsupported step profile %q. supported profiles are %s", name, strings.Join(supported, ", "))
+	}
+	return p, nil
+}
+
+// apply adds the steps and the parameters they need to the input. Generated parameters take precedence.
+func (p stepProfile) apply(input *insertAtInput, properties map[string]any, in stepInput) {
+	for k, v := range p.parameters {
+		if _, ok := properties[k]; !ok {
+			properties[k] = v
+		}
+	}
+	for _, r := range p.required {
+		if !contains(input.required, r) {
+			input.required = append(input.required, r)
+		}
+	}
+	input.steps = p.steps(in)
+}
+
+func serializeStep(in stepInput) map[string]any {
+	metadata := map[string]any{
+		"name": "${{ parameters.name }}",
+	}
+	if in.namespaced {
+		metadata["namespace"] = "${{ parameters.namespace }}"
+	}
+	var spec any = "${{ parameters.config }}"
+	if len(in.configFields) > 0 {
+		// the configuration is spread over the parameters of several pages
+		fields := make(map[string]any, len(in.configFields))
+		for field, param := range in.configFields {
+			fields[field] = fmt.Sprintf("${{ parameters.%s%s }}", param, fieldAccessor(field))
+		}
+		spec = fields
+	}
+	return map[string]any{
+		"id":     "serialize",
+		"name":   "serialize",
+		"action": "roadiehq:utils:serialize:yaml",
+		"input": map[string]any{
+			"data": map[string]any{
+				"apiVersion": "${{ parameters.apiVersion }}",
+				"kind":       "${{ parameters.kind }}",
+				"metadata":   metadata,
+				"spec":       spec,
+			},
+		},
+	}
+}
+
+// fieldAccessor returns the template expression accessing the field of an object.
+func fieldAccessor(field string) string {
+	if templateIdentifier.MatchString(field) {
+		return "." + field
+	}
+	return fmt.Sprintf("['%s']", strings.ReplaceAll(field, "'", "\\'"))
+}
+
+func k8sApplySteps(in stepInput) []any {
+	steps := make([]any, 0, 4)
+	if in.verifiers {
+		steps = append(steps, map[string]any{
+			"id":     "verify",
+			"name":   "verify",
+			"action": "cnoe:verify:dependency",
+			"input": map[string]any{
+				"verifiers": "${{ parameters.verifiers }}",
+			},
+		})
+	}
+	return append(steps,
+		serializeStep(in),
+		map[string]any{
+			"id":     "sanitize",
+			"name":   "sanitize",
+			"action": "cnoe:utils:sanitize",
+			"input": map[string]any{
+				"document": "${{ steps['serialize'].output.serialized }}",
+			},
+		},
+		map[string]any{
+			"id":     "apply",
+			"name":   "apply-manifest",
+			"action": "cnoe:kubernetes:apply",
+			"input": map[string]any{
+				"namespaced": in.namespaced,
+				"manifest":   "${{ steps['sanitize'].output.sanitized }}",
+			},
+		},
+	)
+}
+
+func gitHubPRSteps(in stepInput) []any {
+	return []any{
+		serializeStep(in),
+		map[string]any{
+			"id":     "write",
+			"name":   "write-to-file",
+			"action": "roadiehq:utils:fs:write",
+			"input": map[string]any{
+				"path":    "${{ parameters.path }}/${{ parameters.name }}.yaml",
+				"content": "${{ steps['serialize'].output.serialized }}",
+			},
+		},
+		map[string]any{
+			"id":     "pullRequest",
+			"name":   "create-PR",
+			"action": "publish:github:pull-request",
+			"input": map[string]any{
+				"repoUrl":     "${{ parameters.repoUrl }}",
+				"branchName":  "${{ parameters.name }}-${{ parameters.kind }}-${{ user.entity.metadata.name }}",
+				"title":       "Add ${{ parameters.kind }} ${{ parameters.name }}",
+				"description": "Add ${{ parameters.kind }} ${{ parameters.name }}",
+			},
+		},
+	}
+}
+
+func tfVarsPRSteps(in stepInput) []any {
+	data := make(map[string]any, len(in.variables))
+	for _, v := range in.variables {
+		data[v] = fmt.Sprintf("${{ parameters.%s }}", v)
+	}
+	steps := []any{
+		map[string]any{
+			"id":     "serialize",
+			"name":   "serialize",
+			"action": "roadiehq:utils:serialize:json",
+			"input": map[string]any{
+				"data": data,
+			},
+		},
+		map[string]any{
+			"id":     "write",
+			"name":   "write-to-file",
+			"action": "roadiehq:utils:fs:write",
+			"input": map[string]any{
+				"path":    "${{ parameters.path }}/terraform.tfvars.json",
+				"content": "${{ steps['serialize'].output.serialized }}",
+			},
+		},
+	}
+	if len(in.secrets) > 0 {
+		// secret values are passed to terraform as TF_VAR environment variables of the runner
+		env := make([]any, 0, len(in.secrets))
+		for _, v := range in.secrets {
+			env = append(env, map[string]any{
+				"name": fmt.Sprintf("TF_VAR_%s", v),
+				"valueFrom": map[string]any{
+					"secretKeyRef": map[string]any{
+						"name": fmt.Sprintf("${{ parameters.%s.name }}", v),
+						"key":  fmt.Sprintf("${{ parameters.%s.key }}", v),
+					},
+				},
+			})
+		}
+		steps = append(steps,
+			map[string]any{
+				"id":     "serializeSecrets",
+				"name":   "serialize-secrets",
+				"action": "roadiehq:utils:serialize:yaml",
+				"input": map[string]any{
+					"data": map[string]any{
+						"env": env,
+					},
+				},
+			},
+			map[string]any{
+				"id":     "writeSecrets",
+				"name":   "write-secrets-to-file",
+				"action": "roadiehq:utils:fs:write",
+				"input": map[string]any{
+					"path":    "${{ parameters.path }}/terraform.env.yaml",
+					"content": "${{ steps['serializeSecrets'].output.serialized }}",
+				},
+			},
+		)
+	}
+	return append(steps,
+		map[string]any{
+			"id":     "pullRequest",
+			"name":   "create-PR",
+			"action": "publish:github:pull-request",
+			"input": map[string]any{
+				"repoUrl":     "${{ parameters.repoUrl }}",
+				"branchName":  fmt.Sprintf("%s-${{ user.entity.metadata.name }}", in.name),
+				"title":       fmt.Sprintf("Update %s variables", in.name),
+				"description": fmt.Sprintf("Update variables of the %s module", in.name),
+			},
+		},
+	)
+}
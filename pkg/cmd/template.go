@@ -3,15 +3,22 @@ package cmd
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io"
 	"log"
 	"path/filepath"
+	"runtime"
 
+	"github.com/cnoe-io/cnoe-cli/pkg/models"
+	"github.com/hashicorp/go-multierror"
 	"github.com/spf13/cobra"
 )
 
 var templateCmd = &cobra.Command{
 	Use:   "template",
 	Short: "Generate Backstage templates",
+	// errors such as ErrOutputChanged are not caused by wrong usage
+	SilenceUsage: true,
 }
 
 const (
@@ -26,6 +33,28 @@ var (
 	templatePath   string
 	collapsed      bool
 	raw            bool
+	uiHints        bool
+	uiRulesFile    string
+	splitBy        string
+	pagesFile      string
+	stepsProfile   string
+	catalogInfo    bool
+	catalogName    string
+	index          bool
+	workers        int
+	failFast       bool
+	dryRun         bool
+	diff           bool
+	merge          bool
+	overlayDir     string
+	prune          bool
+	insertionsFile string
+
+	templateName        string
+	templateTitle       string
+	templateDescription string
+	templateTags        []string
+	templateOwner       string
 )
 
 func init() {
@@ -37,16 +66,47 @@ func init() {
 	templateCmd.PersistentFlags().StringVarP(&insertionPoint, "insertAt", "p", ".spec.parameters[0]", "jq path within the template to insert backstage info")
 	templateCmd.PersistentFlags().BoolVarP(&collapsed, "colllapse", "c", false, "if set to true, items are rendered and collapsed as drop down items in a single specified template")
 	templateCmd.PersistentFlags().BoolVarP(&raw, "raw", "", false, "prints the raw open API output without putting it into a template (ignoring `templatePath` and `insertAt`)")
+	templateCmd.PersistentFlags().BoolVarP(&uiHints, "uiHints", "", false, "infer Backstage ui:* hints such as widgets and help texts from the schema")
+	templateCmd.PersistentFlags().StringVarP(&splitBy, "splitBy", "", "", "split generated properties into multiple wizard pages by group (top-level objects), required or file. Requires --steps for CRDs")
+	templateCmd.PersistentFlags().StringVarP(&pagesFile, "pagesFile", "", "", "path to a file grouping properties into wizard pages (implies --splitBy file)")
+	templateCmd.PersistentFlags().StringVarP(&stepsProfile, "steps", "", "", "generate the template steps from a profile: k8s-apply or github-pr for CRDs, tfvars-pr for Terraform modules")
+	templateCmd.PersistentFlags().BoolVarP(&catalogInfo, "catalogInfo", "", false, "write a catalog-info.yaml Location listing the generated templates to the output directory")
+	templateCmd.PersistentFlags().StringVarP(&catalogName, "catalogName", "", "", "name of the generated Location, defaults to the name of the output directory")
+	templateCmd.PersistentFlags().BoolVarP(&index, "index", "", false, "write an index.yaml listing the generated files and the definitions they were generated from")
+	templateCmd.PersistentFlags().StringVarP(&templateName, "templateName", "", "", "sets the name of the template, defaults to the name of the generated file. Supports Go templates such as {{.Kind}}")
+	templateCmd.PersistentFlags().StringVarP(&templateTitle, "templateTitle", "", "", "sets the title of the template, defaults to the kind or module name. Supports Go templates")
+	templateCmd.PersistentFlags().StringVarP(&templateDescription, "templateDescription", "", "", "sets the description of the template. Supports Go templates")
+	templateCmd.PersistentFlags().StringSliceVarP(&templateTags, "templateTags", "", []string{}, "tags added to the template. Supports Go templates")
+	templateCmd.PersistentFlags().StringVarP(&templateOwner, "templateOwner", "", "", "sets the owner of the template. Supports Go templates")
+	templateCmd.PersistentFlags().IntVarP(&workers, "workers", "", runtime.NumCPU(), "number of definitions processed in parallel")
+	templateCmd.PersistentFlags().BoolVarP(&failFast, "fail-fast", "", false, "stop at the first definition that cannot be processed instead of reporting all failures at the end")
+	templateCmd.PersistentFlags().BoolVarP(&dryRun, "dry-run", "", false, "print the files that would be created, changed or removed without writing them. Exits with an error if there are changes")
+	templateCmd.PersistentFlags().BoolVarP(&diff, "diff", "", false, "like --dry-run, and additionally print the semantic differences of changed files")
+	templateCmd.PersistentFlags().BoolVarP(&merge, "merge", "", false, "keep hand edits of previously generated files and report values that were both edited and generated differently")
+	templateCmd.PersistentFlags().StringVarP(&overlayDir, "overlayDir", "", "", "directory with overlays applied to the generated templates in addition to the overlays next to the inputs")
+	templateCmd.PersistentFlags().BoolVarP(&prune, "prune", "", false, "remove previously generated files whose definitions are gone, based on a manifest kept in the output directory")
+	templateCmd.PersistentFlags().StringVarP(&insertionsFile, "insertions", "", "", "path to a file mapping generated fragments (properties, required, dependencies, steps, metadata, owner) to jq paths of the template")
+	templateCmd.PersistentFlags().StringVarP(&uiRulesFile, "uiRules", "", "", "path to a file with additional rules for inferring ui:* hints (implies --uiHints)")
 
 	templateCmd.MarkFlagRequired("inputDir")
 	templateCmd.MarkFlagRequired("outputDir")
 }
 
+// optionalInputDir lifts the inputDir requirement for commands reading definitions from elsewhere. Required flags are
+// validated after the pre-run hooks.
+func optionalInputDir(cmd *cobra.Command) error {
+	return cmd.Flags().SetAnnotation("inputDir", cobra.BashCompOneRequiredFlag, []string{"false"})
+}
+
 func templatePreRunE(cmd *cobra.Command, args []string) error {
 	if !isDirectory(inputDir) {
 		return errors.New("inputDir must be a directory")
 	}
+	return checkTemplateFlags()
+}
 
+// checkTemplateFlags validates the combination of template flags.
+func checkTemplateFlags() error {
 	if collapsed && templatePath == "" && !raw {
 		return errors.New("templatePath flag must be specified when using the `collapse` flag (optionally you can use `insertAt` as well)")
 	}
@@ -55,6 +115,14 @@ func templatePreRunE(cmd *cobra.Command, args []string) error {
 		return errors.New("you either need to use the `raw` flag to generate raw OpenAPI files or define a `templatePath` for the tool to populate")
 	}
 
+	if (splitBy != "" || pagesFile != "") && (collapsed || raw) {
+		return errors.New("wizard pages can only be generated for templates that are neither collapsed nor raw")
+	}
+
+	if stepsProfile != "" && (collapsed || raw) {
+		return errors.New("steps can only be generated for templates that are neither collapsed nor raw")
+	}
+
 	return nil
 }
 
@@ -67,15 +135,136 @@ type EntityConfig struct {
 	Defenitions    []string
 	Collapsed      bool
 	Raw            bool
+	// UIRules enables inferring ui:* hints for generated fields when set.
+	UIRules         *models.UIRules
+	compiledUIRules *compiledUIRules
+	// SplitBy splits generated properties into multiple wizard pages. Pages are used when splitting by file.
+	SplitBy string
+	Pages   []models.Page
+	// Steps is the name of the profile used to generate the template steps.
+	Steps string
+	// CatalogInfo writes a Location entity for the generated templates, named CatalogName.
+	CatalogInfo bool
+	CatalogName string
+	// Index writes a list of the generated files and their sources.
+	Index bool
+	// Template metadata. Values are Go templates rendered with the values of each generated template. Name and title
+	// are derived from the definition when empty.
+	TemplateName        string
+	TemplateTitle       string
+	TemplateDescription string
+	TemplateTags        []string
+	TemplateOwner       string
+	// Workers is the number of definitions handled in parallel. Definitions are handled one by one when zero.
+	Workers int
+	// FailFast stops processing at the first definition that fails. Otherwise the failures of all definitions are
+	// reported once the others are written.
+	FailFast bool
+	// DryRun compares the generated files with the output directory instead of writing them and reports the files
+	// that would be created, changed or removed to Out. Diff additionally reports the changed values and implies
+	// DryRun. Process returns ErrOutputChanged when there are changes.
+	DryRun bool
+	Diff   bool
+	Out    io.Writer
+	// Merge keeps hand edits of generated files. A copy of each generated file is kept in MergeBaseDir to tell edits
+	// from generated values. Files with values that were both edited and generated differently are left unchanged
+	// and Process returns ErrMergeConflict.
+	Merge bool
+	// OverlayDir holds overlays applied to the generated content in addition to the overlays found next to the
+	// definitions. Overlays are JSON Merge Patches, JSON Patches or jq expressions named after the generated file.
+	OverlayDir string
+	// Prune removes the files generated by a previous run that are not generated anymore. The generated files are
+	// recorded in ManifestFile on every run, files that are not listed there are never removed.
+	Prune bool
+	// Insertions place generated fragments at their own paths of the template with the given merge. Fragments
+	// without an insertion are inserted at InsertionPoint.
+	Insertions []models.Insertion
+}
+
+// applyTemplateFlags sets the options shared by all template subcommands on the given config.
+func applyTemplateFlags(c *EntityConfig) error {
+	if uiHints || uiRulesFile != "" {
+		rules, err := LoadUIRules(uiRulesFile)
+		if err != nil {
+			return err
+		}
+		c.UIRules = rules
+	}
+	c.SplitBy = splitBy
+	c.Steps = stepsProfile
+	c.CatalogInfo = catalogInfo
+	c.CatalogName = catalogName
+	c.Index = index
+	c.TemplateName = templateName
+	c.TemplateTitle = templateTitle
+	c.TemplateDescription = templateDescription
+	c.TemplateTags = templateTags
+	c.TemplateOwner = templateOwner
+	c.Workers = workers
+	c.FailFast = failFast
+	c.DryRun = dryRun
+	c.Diff = diff
+	c.Merge = merge
+	c.OverlayDir = overlayDir
+	c.Prune = prune
+	if insertionsFile != "" {
+		insertions, err := LoadInsertions(insertionsFile)
+		if err != nil {
+			return err
+		}
+		c.Insertions = insertions
+	}
+	if pagesFile != "" {
+		pages, err := LoadPages(pagesFile)
+		if err != nil {
+			return err
+		}
+		c.SplitBy = SplitByFile
+		c.Pages = pages
+	}
+	return nil
+}
+
+// EntityOutput is a single file generated while handling a definition.
+type EntityOutput struct {
+	Content  any
+	FileName string
+	// Source is the file or directory the output was generated from.
+	Source string
+	// Definition identifies what was rendered, e.g. the group, version and kind of a CRD.
+	Definition string
+	// Sidecar outputs describe a template and are written next to it. They are not templates themselves.
+	Sidecar bool
 }
 
 type Entity interface {
-	GetDefinitions(string, uint32) ([]string, error)
-	HandleEntry(context.Context, string, string, string) (any, string, error)
+	GetDefinitions(context.Context, string, uint32) ([]string, error)
+	HandleEntry(context.Context, string, string, string) ([]EntityOutput, error)
 	Config() EntityConfig
 }
 
+// configurable entities let Process prepare their config once before the definitions are handled.
+type configurable interface {
+	entityConfig() *EntityConfig
+}
+
+func (c *EntityConfig) entityConfig() *EntityConfig {
+	return c
+}
+
+var (
+	_ configurable = &CRDModule{}
+	_ configurable = &TerraformModule{}
+	_ configurable = &HelmChart{}
+	_ configurable = &OpenAPISpec{}
+)
+
 func Process(ctx context.Context, p Entity) error {
+	if e, ok := p.(configurable); ok {
+		if err := e.entityConfig().prepareUIRules(); err != nil {
+			return err
+		}
+	}
 	c := p.Config()
 
 	expectedInDir, expectedOutDir, expectedTemplateFile, err := prepDirectories(
@@ -83,42 +272,95 @@ func Process(ctx context.Context, p Entity) error {
 		c.OutputDir,
 		c.TemplateFile,
 		c.Collapsed && !c.Raw, /* only generate nesting if templates need to collapse and not printed as raw*/
+		!c.DryRun && !c.Diff,
 	)
 	if err != nil {
 		return err
 	}
+	outputRoot := expectedOutDir
+	if shouldCreateCollapsedTemplate(p) {
+		outputRoot = filepath.Dir(expectedOutDir)
+	}
+	w := newOutputWriter(c, outputRoot)
 
-	definitions, err := p.GetDefinitions(expectedInDir, 0)
+	definitions, err := p.GetDefinitions(ctx, expectedInDir, 0)
 	if err != nil {
 		return err
 	}
 	log.Printf("processing %d definitions", len(definitions))
 
 	templateOutputFiles := make([]string, 0)
+	written := make([]EntityOutput, 0)
 
-	for _, def := range definitions {
-		content, contentFileName, err := p.HandleEntry(ctx, def, expectedOutDir, expectedTemplateFile)
-		if err != nil {
-			return err
-		}
-		if content != nil { // write the content and record the file name
-			err = writeOutput(content, contentFileName)
+	results, entryErr := handleEntries(ctx, p, definitions, expectedOutDir, expectedTemplateFile)
+	if entryErr != nil && (c.FailFast || ctx.Err() != nil) {
+		return entryErr
+	}
+	var writeErr *multierror.Error
+	for _, outputs := range results {
+		for _, out := range outputs { // write the content and record the file name
+			if out.Content == nil {
+				continue
+			}
+			err = w.write(out.Content, out.FileName)
 			if err != nil {
-				log.Printf("wrinting content failed for %s", contentFileName)
+				writeErr = multierror.Append(writeErr, fmt.Errorf("failed to write %s: %w", out.FileName, err))
 				continue
 			}
-			templateOutputFiles = append(templateOutputFiles, contentFileName)
+			if out.Sidecar {
+				continue
+			}
+			templateOutputFiles = append(templateOutputFiles, out.FileName)
+			written = append(written, out)
 		}
 	}
 
+	if writeErr != nil {
+		// like failed definitions, files that could not be written are reported at the end
+		log.Printf("failed to write %d files", len(writeErr.Errors))
+		entryErr = multierror.Append(entryErr, writeErr.Errors...)
+	}
+
+	templates := templateOutputFiles
 	if shouldCreateCollapsedTemplate(p) && len(templateOutputFiles) > 0 {
-		generatedTemplateFile := filepath.Join(expectedOutDir, "../template.yaml")
+		generatedTemplateFile := filepath.Join(outputRoot, "template.yaml")
 		input := insertAtInput{
 			templatePath:     expectedTemplateFile,
 			jqPathExpression: c.InsertionPoint,
+			insertions:       c.Insertions,
 		}
-		return writeCollapsedTemplate(ctx, input, generatedTemplateFile, templateOutputFiles)
+		input.metadata, input.owner, err = c.templateMetadata(templateValues{}, false)
+		if err != nil {
+			return err
+		}
+		err = writeCollapsedTemplate(ctx, w, c, input, generatedTemplateFile, expectedInDir, templateOutputFiles)
+		if err != nil {
+			return err
+		}
+		templates = []string{generatedTemplateFile}
 	}
 
-	return nil
+	if c.CatalogInfo && len(written) > 0 {
+		if c.Raw {
+			log.Printf("skipping %s since raw output does not contain templates", CatalogInfoFile)
+		} else if err := writeCatalogInfo(w, outputRoot, c.CatalogName, templates); err != nil {
+			return err
+		}
+	}
+	if c.Index && len(written) > 0 {
+		if err := writeIndex(w, expectedInDir, outputRoot, written); err != nil {
+			return err
+		}
+	}
+
+	if err := w.prune(entryErr == nil); err != nil {
+		return err
+	}
+	if err := w.findUntracked(expectedOutDir, outputRoot); err != nil {
+		return err
+	}
+	if err := w.report(); entryErr == nil {
+		return err
+	}
+	return entryErr
 }
@@ -6,8 +6,10 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
+	"github.com/cnoe-io/cnoe-cli/pkg/lib"
 	"github.com/cnoe-io/cnoe-cli/pkg/models"
 	"github.com/hashicorp/terraform-config-inspect/tfconfig"
 	"github.com/spf13/cobra"
@@ -21,25 +23,85 @@ var (
 			"then create output file per module.\n" +
 			"If the templatePath and insertionPoint flags are set, generated objects are merged into the given template at given insertion point.\n" +
 			"Otherwise a yaml file with two keys are generated. The properties key contains the generated form input. " +
-			"The required key contains the TF variable names that do not have defaults.",
-		PreRunE: templatePreRunE,
-		RunE:    tfE,
+			"The required key contains the TF variable names that do not have usable defaults.",
+		PreRunE:      tfPreRunE,
+		RunE:         tfE,
+		SilenceUsage: true,
 	}
 )
 
+var (
+	sensitiveMode   string
+	objectDefaults  bool
+	moduleSources   []string
+	moduleCacheDir  string
+	offline         bool
+	writeModuleInfo bool
+)
+
 func init() {
 	templateCmd.AddCommand(tfCmd)
+	tfCmd.Flags().StringArrayVarP(&moduleSources, "source", "s", []string{}, "module source to generate a template for, e.g. a registry address such as ns/name/provider@1.0.0, a git repository or an archive. Can be repeated")
+	tfCmd.Flags().StringVarP(&moduleCacheDir, "cacheDir", "", defaultModuleCacheDir(), "directory fetched module sources are stored in")
+	tfCmd.Flags().BoolVarP(&offline, "offline", "", false, "only use module sources already in the cache directory")
+	tfCmd.Flags().BoolVarP(&writeModuleInfo, "moduleInfo", "", false, "write the outputs, provider requirements and module calls of each module to a <module>.module.yaml file next to the template")
+	tfCmd.Flags().BoolVarP(&objectDefaults, "objectDefaults", "", false, "set defaults of object and map variables. Older Backstage versions do not allow removing them in the UI")
+	tfCmd.Flags().StringVarP(&sensitiveMode, "sensitive", "", SensitivePassword, "how sensitive variables are rendered: password (a masked field without default) or secret-ref (a reference to a Kubernetes secret, passed to Terraform as a TF_VAR environment variable by the tfvars-pr steps)")
+}
+
+// tfPreRunE allows omitting the input directory when module sources are given.
+func tfPreRunE(cmd *cobra.Command, args []string) error {
+	if inputDir == "" && len(moduleSources) > 0 {
+		if err := optionalInputDir(cmd); err != nil {
+			return err
+		}
+		return checkTemplateFlags()
+	}
+	return templatePreRunE(cmd, args)
+}
+
+func defaultModuleCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return filepath.Join(".cnoe", "modules")
+	}
+	return filepath.Join(dir, "cnoe", "modules")
 }
 
 func tfE(cmd *cobra.Command, args []string) error {
-	return Process(cmd.Context(), NewTerraformModule(inputDir, outputDir, templatePath, insertionPoint, collapsed, raw))
+	if sensitiveMode != SensitivePassword && sensitiveMode != SensitiveSecretRef {
+		return fmt.Errorf("unsupported value %q for sensitive. supported values are %s, %s", sensitiveMode, SensitivePassword, SensitiveSecretRef)
+	}
+	m := NewTerraformModule(inputDir, outputDir, templatePath, insertionPoint, collapsed, raw)
+	m.SensitiveMode = sensitiveMode
+	m.ObjectDefaults = objectDefaults
+	m.Sources = moduleSources
+	m.ModuleInfo = writeModuleInfo
+	m.Fetcher = lib.NewModuleFetcher(moduleCacheDir, offline)
+	if err := applyTemplateFlags(&m.EntityConfig); err != nil {
+		return err
+	}
+	return Process(cmd.Context(), m)
 }
 
 type TerraformModule struct {
 	EntityConfig
+
+	// SensitiveMode decides how sensitive variables are rendered. Defaults to SensitivePassword.
+	SensitiveMode string
+	// ObjectDefaults sets defaults of object and map variables.
+	ObjectDefaults bool
+	// ModuleInfo writes the outputs, provider requirements and module calls of each module next to its template.
+	ModuleInfo bool
+	// Sources are module source addresses generated in addition to the modules in the input directory. They are
+	// fetched with Fetcher.
+	Sources []string
+	Fetcher lib.IModuleFetcher
+
+	remote map[string]lib.ModuleSource
 }
 
-func NewTerraformModule(inputDir, outputDir, templatePath, insertionPoint string, collapsed, raw bool) Entity {
+func NewTerraformModule(inputDir, outputDir, templatePath, insertionPoint string, collapsed, raw bool) *TerraformModule {
 	return &TerraformModule{
 		EntityConfig: EntityConfig{
 			InputDir:       inputDir,
@@ -56,49 +118,134 @@ func (t *TerraformModule) Config() EntityConfig {
 	return t.EntityConfig
 }
 
-func (t *TerraformModule) HandleEntry(ctx context.Context, def, expectedOutDir, templateFile string) (any, string, error) {
+func (t *TerraformModule) HandleEntry(ctx context.Context, def, expectedOutDir, templateFile string) ([]EntityOutput, error) {
 	log.Printf("processing module at %s", def)
 	mod, diag := tfconfig.LoadModule(def)
 	if diag.HasErrors() {
-		return nil, "", diag.Err()
+		return nil, diag.Err()
 	}
 
 	if len(mod.Variables) == 0 {
 		log.Printf("module %s does not have variables", def)
-		return nil, "", nil
+		return nil, nil
+	}
+
+	blocks, err := readVariableBlocks(def)
+	if err != nil {
+		log.Printf("could not read variable validations of module %s: %s", def, err)
 	}
 
 	params := make(map[string]models.BackstageParamFields)
 	required := make([]string, 0)
+	sensitive := make([]string, 0)
 	for j := range mod.Variables {
-		params[j] = convertVariable(*mod.Variables[j])
-		if mod.Variables[j].Required {
+		p := convertVariable(*mod.Variables[j], t.ObjectDefaults)
+		applyValidations(j, &p, blocks[j].validations)
+		if mod.Variables[j].Sensitive {
+			p = t.sensitiveField(j, p)
+			sensitive = append(sensitive, j)
+		}
+		params[j] = p
+		if blocks[j].required(*mod.Variables[j]) {
 			required = append(required, j)
 		}
 	}
+	sort.Strings(required)
+
+	if t.UIRules != nil {
+		hints, err := t.uiHints()
+		if err != nil {
+			return nil, err
+		}
+		for name := range params {
+			p := params[name]
+			hints.applyUIHintFields(name, &p)
+			params[name] = p
+		}
+	}
 
-	fileName := filepath.Join(expectedOutDir, fmt.Sprintf("%s.yaml", filepath.Base(def)))
-	content, err := t.createContent(ctx, templateFile, params, required)
+	name, source := t.moduleName(def)
+	description := readmeDescription(def)
+	fileName := filepath.Join(expectedOutDir, fmt.Sprintf("%s.yaml", name))
+	content, err := t.createContent(ctx, templateValues{Name: name, Title: name, Module: name, Description: description}, templateFile, params, required, sensitive)
 	if err != nil {
 		log.Printf("failed to write %s: %s \n", def, err.Error())
-		return nil, "", err
+		return nil, err
 	}
 
-	return content, fileName, nil
+	outputs := []EntityOutput{{
+		Content:    content,
+		FileName:   fileName,
+		Source:     source,
+		Definition: fmt.Sprintf("module %s", name),
+	}}
+	if t.ModuleInfo {
+		// only remote sources are meaningful outside of this machine
+		info := newModuleInfo(mod, name, t.remote[def].Address, description)
+		outputs = append(outputs, EntityOutput{
+			Content:  info,
+			FileName: filepath.Join(expectedOutDir, fmt.Sprintf("%s%s", name, moduleInfoSuffix)),
+			Source:   source,
+			Sidecar:  true,
+		})
+	}
+	return outputs, nil
 }
 
-func (t *TerraformModule) createContent(ctx context.Context, templateFile string, properties map[string]models.BackstageParamFields, required []string) (any, error) {
+func (t *TerraformModule) createContent(ctx context.Context, v templateValues, templateFile string, properties map[string]models.BackstageParamFields, required, sensitive []string) (any, error) {
 	if shouldCreateNonCollapsedTemplate(t) {
+		props := make(map[string]any, len(properties))
+		for k, v := range properties {
+			props[k] = v
+		}
 		input := insertAtInput{
 			templatePath:     t.TemplateFile,
-			jqPathExpression: insertionPoint,
+			jqPathExpression: t.InsertionPoint,
 			fields: map[string]interface{}{
-				"properties": properties,
+				"properties": props,
 			},
+			insertions: t.Insertions,
+		}
+		var err error
+		input.metadata, input.owner, err = t.templateMetadata(v, true)
+		if err != nil {
+			return nil, err
 		}
 		if len(required) > 0 {
 			input.required = required
 		}
+		if t.SplitBy != "" {
+			first, rest, err := splitPages(t.SplitBy, t.Pages, props, required)
+			if err != nil {
+				return nil, err
+			}
+			input.fields["properties"] = first.properties
+			input.required = first.required
+			for _, p := range rest {
+				input.pages = append(input.pages, p.toParameters(p.properties, p.required))
+			}
+		}
+		if t.Steps != "" {
+			profile, err := lookupStepProfile(tfStepProfiles, t.Steps)
+			if err != nil {
+				return nil, err
+			}
+			// sensitive values must not end up in a repository, only references to the secrets holding them
+			if len(sensitive) > 0 && t.SensitiveMode != SensitiveSecretRef {
+				sort.Strings(sensitive)
+				return nil, fmt.Errorf("sensitive variables %s cannot be written by the %s steps. use the %s sensitive mode", strings.Join(sensitive, ", "), t.Steps, SensitiveSecretRef)
+			}
+			variables := make([]string, 0, len(props))
+			secrets := make([]string, 0, len(sensitive))
+			for _, k := range sortedKeys(props) {
+				if contains(sensitive, k) {
+					secrets = append(secrets, k)
+				} else {
+					variables = append(variables, k)
+				}
+			}
+			profile.apply(&input, input.fields["properties"].(map[string]any), stepInput{name: v.Name, variables: variables, secrets: secrets})
+		}
 		content, err := insertAt(ctx, input)
 		if err != nil {
 			return nil, fmt.Errorf("failed to insert to given template: %s", err)
@@ -113,147 +260,87 @@ func (t *TerraformModule) createContent(ctx context.Context, templateFile string
 	return content, nil
 }
 
-func (t *TerraformModule) GetDefinitions(inputDir string, currentDepth uint32) ([]string, error) {
-	if currentDepth > depth {
-		return nil, nil
-	}
-	if tfconfig.IsModuleDir(inputDir) {
-		return []string{inputDir}, nil
+// GetDefinitions returns the modules found in the input directory followed by the fetched module sources.
+func (t *TerraformModule) GetDefinitions(ctx context.Context, inputDir string, currentDepth uint32) ([]string, error) {
+	out := make([]string, 0)
+	if t.InputDir != "" {
+		local, err := t.findModules(ctx, inputDir, currentDepth)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, local...)
 	}
-	out, err := getRelevantFiles(inputDir, currentDepth, t.findModule)
+	remote, err := t.fetchSources(ctx)
 	if err != nil {
 		return nil, err
 	}
-	return out, nil
+	return append(out, remote...), nil
 }
 
-func (t *TerraformModule) findModule(file os.DirEntry, currentDepth uint32, base string) ([]string, error) {
-	f := filepath.Join(base, file.Name())
-	stat, err := os.Stat(f)
-	if err != nil {
-		return nil, err
+// fetchSources makes the module sources available locally and remembers where each of them came from.
+func (t *TerraformModule) fetchSources(ctx context.Context) ([]string, error) {
+	if len(t.Sources) == 0 {
+		return nil, nil
 	}
-	if stat.IsDir() {
-		mods, err := t.GetDefinitions(f, currentDepth+1)
+	fetcher := t.Fetcher
+	if fetcher == nil {
+		fetcher = lib.NewModuleFetcher(defaultModuleCacheDir(), false)
+	}
+	t.remote = make(map[string]lib.ModuleSource, len(t.Sources))
+	out := make([]string, 0, len(t.Sources))
+	for _, address := range t.Sources {
+		source, err := lib.ParseModuleSource(address)
 		if err != nil {
 			return nil, err
 		}
-		return mods, nil
-	}
-	return nil, nil
-}
-
-func convertVariable(tfVar tfconfig.Variable) models.BackstageParamFields {
-	tfType := cleanString(tfVar.Type)
-	t := mapType(tfType)
-	if isPrimitive(tfType) {
-		b := models.BackstageParamFields{
-			Type: t,
-		}
-		if tfVar.Description != "" {
-			b.Description = tfVar.Description
+		log.Printf("fetching module %s", address)
+		dir, err := fetcher.Fetch(ctx, source)
+		if err != nil {
+			return nil, err
 		}
-		if tfVar.Default != nil {
-			b.Default = tfVar.Default
+		if !tfconfig.IsModuleDir(dir) {
+			return nil, fmt.Errorf("module source %s does not contain terraform files", address)
 		}
-		return b
+		t.remote[dir] = source
+		out = append(out, dir)
 	}
+	return out, nil
+}
 
-	if t == "array" {
-		return convertArray(tfVar)
-	}
-	if t == "object" {
-		return convertObject(tfVar)
+// moduleName returns the name of the module at dir and where it came from.
+func (t *TerraformModule) moduleName(dir string) (string, string) {
+	if source, ok := t.remote[dir]; ok {
+		return source.ModuleName(), source.Address
 	}
-	return models.BackstageParamFields{}
+	return filepath.Base(dir), dir
 }
 
-func convertArray(tfVar tfconfig.Variable) models.BackstageParamFields {
-	tfType := cleanString(tfVar.Type)
-	nestedType := getNestedType(tfType)
-	nestedTfVar := tfconfig.Variable{
-		Name: fmt.Sprintf("%s-a", tfVar.Name),
-		Type: nestedType,
+func (t *TerraformModule) findModules(ctx context.Context, inputDir string, currentDepth uint32) ([]string, error) {
+	if currentDepth > depth {
+		return nil, nil
 	}
-	nestedItems := convertVariable(nestedTfVar)
-	out := models.BackstageParamFields{
-		Type:        "array",
-		Description: tfVar.Description,
-		Default:     tfVar.Default,
-		Items:       &nestedItems,
+	if tfconfig.IsModuleDir(inputDir) {
+		return []string{inputDir}, nil
 	}
-	if strings.HasPrefix(tfType, "set") {
-		u := true
-		out.UniqueItems = &u
+	out, err := getRelevantFiles(ctx, inputDir, currentDepth, t.findModule)
+	if err != nil {
+		return nil, err
 	}
-	return out
+	return out, nil
 }
 
-func convertObject(tfVar tfconfig.Variable) models.BackstageParamFields {
-	out := models.BackstageParamFields{
-		Title:       tfVar.Name,
-		Type:        mapType(cleanString(tfVar.Type)),
-		Description: tfVar.Description,
+func (t *TerraformModule) findModule(ctx context.Context, file os.DirEntry, currentDepth uint32, base string) ([]string, error) {
+	f := filepath.Join(base, file.Name())
+	stat, err := os.Stat(f)
+	if err != nil {
+		return nil, err
 	}
-
-	nestedType := getNestedType(cleanString(tfVar.Type))
-	if isPrimitive(nestedType) {
-		p := models.AdditionalProperties{Type: mapType(nestedType)}
-		out.AdditionalProperties = &p
-		// defaults for object type is broken in Backstage atm. In the UI, the default values cannot be removed.
-		// we will enable this once it's fixed in Backstage.
-		//properties := convertObjectDefaults(tfVar)
-		//if len(properties) > 0 {
-		//	out.Properties = properties
-		//}
-	} else {
-		name := fmt.Sprintf("%s-n", tfVar.Name)
-		nestedTfVar := tfconfig.Variable{
-			Name: name,
-			Type: nestedType,
-		}
-		converted := convertVariable(nestedTfVar)
-		out.Properties = map[string]*models.BackstageParamFields{
-			name: &converted,
+	if stat.IsDir() {
+		mods, err := t.findModules(ctx, f, currentDepth+1)
+		if err != nil {
+			return nil, err
 		}
+		return mods, nil
 	}
-	return out
-}
-
-func cleanString(input string) string {
-	return strings.ReplaceAll(input, " ", "")
-}
-
-func isPrimitive(s string) bool {
-	return s == "string" || s == "number" || s == "bool"
-}
-
-func getNestedType(s string) string {
-	if strings.HasPrefix(s, "object(") {
-		return strings.TrimSuffix(strings.SplitAfterN(s, "object(", 1)[1], ")")
-	}
-	if strings.HasPrefix(s, "map(") {
-		return strings.TrimSuffix(strings.SplitAfterN(s, "map(", 2)[1], ")")
-	}
-	if strings.HasPrefix(s, "list(") {
-		return strings.TrimSuffix(strings.SplitAfterN(s, "list(", 2)[1], ")")
-	}
-	return s
-}
-
-func mapType(tfType string) string {
-	switch {
-	case tfType == "string":
-		return "string"
-	case tfType == "number":
-		return "number"
-	case tfType == "bool":
-		return "boolean"
-	case strings.HasPrefix(tfType, "object"), strings.HasPrefix(tfType, "map"):
-		return "object"
-	case strings.HasPrefix(tfType, "list"), strings.HasPrefix(tfType, "set"):
-		return "array"
-	default:
-		return "string"
-	}
+	return nil, nil
 }
@@ -1,17 +1,22 @@
 package cmd_test
 
 import (
+	"archive/zip"
 	"context"
 	"fmt"
 	"log"
 
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/cnoe-io/cnoe-cli/pkg/cmd"
+	"github.com/cnoe-io/cnoe-cli/pkg/lib"
+	"github.com/cnoe-io/cnoe-cli/pkg/lib/libfakes"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/onsi/gomega/gbytes"
+	"sigs.k8s.io/yaml"
 )
 
 var _ = Describe("Terraform Template", func() {
@@ -23,14 +28,41 @@ var _ = Describe("Terraform Template", func() {
 	)
 
 	const (
-		validInputRootDir               = "./fakes/terraform/valid"
-		inputDir                        = "./fakes/terraform/valid/input"
-		inputDirWithRequire             = "./fakes/terraform/valid/input-require"
-		expectedPropertyFile            = "./fakes/terraform/valid/output/properties.yaml"
-		expectedPropertyFileWithRequire = "./fakes/terraform/valid/output/properties-require.yaml"
-		expectedTemplateFile            = "./fakes/terraform/valid/output/full-template.yaml"
-		expectedTemplateFileWithRequire = "./fakes/terraform/valid/output/full-template-require.yaml"
-		targetTemplateFile              = "./fakes/template/input-template.yaml"
+		validInputRootDir                 = "./fakes/terraform/valid"
+		inputDir                          = "./fakes/terraform/valid/input"
+		inputDirWithRequire               = "./fakes/terraform/valid/input-require"
+		expectedPropertyFile              = "./fakes/terraform/valid/output/properties.yaml"
+		expectedPropertyFileWithRequire   = "./fakes/terraform/valid/output/properties-require.yaml"
+		expectedTemplateFile              = "./fakes/terraform/valid/output/full-template.yaml"
+		expectedTemplateFileWithRequire   = "./fakes/terraform/valid/output/full-template-require.yaml"
+		targetTemplateFile                = "./fakes/template/input-template.yaml"
+		uiRulesFile                       = "./fakes/ui/rules.yaml"
+		invalidUIRulesFile                = "./fakes/ui/invalid-rules.yaml"
+		orderUIRulesFile                  = "./fakes/ui/order-rules.yaml"
+		expectedPropertyFileWithUIHints   = "./fakes/ui/output/properties-input.yaml"
+		pagesFile                         = "./fakes/pages/pages.yaml"
+		expectedTemplateWithRequiredPages = "./fakes/pages/output/full-template-required.yaml"
+		expectedTemplateWithFilePages     = "./fakes/pages/output/full-template-file.yaml"
+		expectedTemplateWithTFVarsSteps   = "./fakes/steps/output/full-template-tfvars-pr.yaml"
+		typesInputDir                     = "./fakes/terraform/types/input"
+		expectedPropertyFileWithTypes     = "./fakes/terraform/types/output/properties.yaml"
+		validationInputDir                = "./fakes/terraform/validation/input"
+		expectedPropertyFileWithRules     = "./fakes/terraform/validation/output/properties.yaml"
+		sensitiveInputDir                 = "./fakes/terraform/sensitive/input"
+		expectedSensitivePropertyFile     = "./fakes/terraform/sensitive/output/properties.yaml"
+		expectedSecretRefTemplateFile     = "./fakes/terraform/sensitive/output/full-template-secret-ref.yaml"
+		defaultsInputDir                  = "./fakes/terraform/defaults/input"
+		expectedObjectDefaultsFile        = "./fakes/terraform/defaults/output/properties.yaml"
+		moduleCacheDir                    = "./fakes/terraform/cache"
+		moduleArchive                     = "./fakes/terraform/archive/network.tar.gz"
+		moduleInfoInputDir                = "./fakes/terraform/module/input"
+		expectedModuleInfoFile            = "./fakes/terraform/module/output/input.module.yaml"
+		expectedModuleInfoTemplateFile    = "./fakes/terraform/module/output/full-template.yaml"
+		insertionsTemplateFile            = "./fakes/insertions/template.yaml"
+		requiredTemplateFile              = "./fakes/template/input-template-required.yaml"
+		expectedRequiredTemplateFile      = "./fakes/template/output/full-template-required.yaml"
+		insertionsFile                    = "./fakes/insertions/insertions.yaml"
+		expectedInsertionsTemplateFile    = "./fakes/insertions/output/full-template.yaml"
 	)
 
 	BeforeEach(func() {
@@ -89,6 +121,42 @@ var _ = Describe("Terraform Template", func() {
 		})
 
 	})
+	Context("with a target template and another insertion point", func() {
+		It("should insert the properties at the insertion point of the module", func() {
+			template := filepath.Join(tempDir, "template.yaml")
+			Expect(os.WriteFile(template, []byte(`apiVersion: scaffolder.backstage.io/v1beta3
+kind: Template
+metadata:
+  name: two-pages
+spec:
+  owner: guest
+  type: service
+  parameters:
+    - title: Repository
+      properties:
+        repoUrl:
+          type: string
+    - title: Variables
+      properties: {}
+`), 0644)).To(Succeed())
+			Expect(cmd.Process(context.Background(), cmd.NewTerraformModule(inputDir, outputDir, template, ".spec.parameters[1]", false, false))).To(Succeed())
+
+			generatedData, err := os.ReadFile(fmt.Sprintf("%s/input.yaml", outputDir))
+			Expect(err).NotTo(HaveOccurred())
+			var generated struct {
+				Spec struct {
+					Parameters []struct {
+						Properties map[string]any `json:"properties"`
+					} `json:"parameters"`
+				} `json:"spec"`
+			}
+			Expect(yaml.Unmarshal(generatedData, &generated)).To(Succeed())
+			Expect(generated.Spec.Parameters).To(HaveLen(2))
+			Expect(generated.Spec.Parameters[0].Properties).To(HaveLen(1))
+			Expect(generated.Spec.Parameters[1].Properties).To(HaveKey("name"))
+		})
+	})
+
 	Context("with valid input with required variable and a target template specified", func() {
 		BeforeEach(func() {
 			err := cmd.Process(context.Background(), cmd.NewTerraformModule(inputDirWithRequire, outputDir, targetTemplateFile, ".spec.parameters[0]", false, false))
@@ -104,6 +172,19 @@ var _ = Describe("Terraform Template", func() {
 		})
 	})
 
+	Context("with a target template already requiring a variable", func() {
+		It("should not list the variable as required twice", func() {
+			err := cmd.Process(context.Background(), cmd.NewTerraformModule(inputDirWithRequire, outputDir, requiredTemplateFile, ".spec.parameters[0]", false, false))
+			Expect(err).NotTo(HaveOccurred())
+
+			generatedData, err := os.ReadFile(filepath.Join(outputDir, "input-require.yaml"))
+			Expect(err).NotTo(HaveOccurred())
+			expectedData, err := os.ReadFile(expectedRequiredTemplateFile)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(generatedData).To(MatchYAML(expectedData))
+		})
+	})
+
 	Context("with a root directory specified", func() {
 		BeforeEach(func() {
 			err := cmd.Process(context.Background(), cmd.NewTerraformModule(validInputRootDir, outputDir, "", "", false, true))
@@ -156,4 +237,689 @@ var _ = Describe("Terraform Template", func() {
 
 		})
 	})
+
+	Context("with ui hints enabled", func() {
+		BeforeEach(func() {
+			module := cmd.NewTerraformModule(inputDir, outputDir, "", "", false, true)
+			rules, err := cmd.LoadUIRules(uiRulesFile)
+			Expect(err).NotTo(HaveOccurred())
+			module.UIRules = rules
+			Expect(cmd.Process(context.Background(), module)).To(Succeed())
+		})
+
+		It("should add ui hints inferred from the variables and the rules file", func() {
+			generatedData, err := os.ReadFile(fmt.Sprintf("%s/input.yaml", outputDir))
+			Expect(err).NotTo(HaveOccurred())
+			expectedData, err := os.ReadFile(expectedPropertyFileWithUIHints)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(generatedData).To(MatchYAML(expectedData))
+		})
+	})
+
+	Context("with a field order in the ui rules", func() {
+		BeforeEach(func() {
+			module := cmd.NewTerraformModule(inputDir, outputDir, "", "", false, true)
+			rules, err := cmd.LoadUIRules(orderUIRulesFile)
+			Expect(err).NotTo(HaveOccurred())
+			module.UIRules = rules
+			Expect(cmd.Process(context.Background(), module)).To(Succeed())
+		})
+
+		It("should set the order read from the rules file", func() {
+			generatedData, err := os.ReadFile(fmt.Sprintf("%s/input.yaml", outputDir))
+			Expect(err).NotTo(HaveOccurred())
+			var generated map[string]any
+			Expect(yaml.Unmarshal(generatedData, &generated)).To(Succeed())
+			tags := generated["properties"].(map[string]any)["tags"].(map[string]any)
+			Expect(tags["ui:order"]).To(Equal([]any{"environment", "*"}))
+		})
+	})
+
+	Context("with an unsupported key in the ui rules", func() {
+		It("should fail naming the key", func() {
+			_, err := cmd.LoadUIRules(invalidUIRulesFile)
+			Expect(err).To(MatchError(ContainSubstring("ui:widgt")))
+		})
+	})
+
+	Context("with pages split by required variables", func() {
+		BeforeEach(func() {
+			module := cmd.NewTerraformModule(inputDirWithRequire, outputDir, targetTemplateFile, ".spec.parameters[0]", false, false)
+			module.SplitBy = cmd.SplitByRequired
+			Expect(cmd.Process(context.Background(), module)).To(Succeed())
+		})
+
+		It("should render optional variables on a separate page", func() {
+			generatedData, err := os.ReadFile(fmt.Sprintf("%s/input-require.yaml", outputDir))
+			Expect(err).NotTo(HaveOccurred())
+			expectedData, err := os.ReadFile(expectedTemplateWithRequiredPages)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(generatedData).To(MatchYAML(expectedData))
+		})
+	})
+
+	Context("with pages defined in a file", func() {
+		BeforeEach(func() {
+			module := cmd.NewTerraformModule(inputDir, outputDir, targetTemplateFile, ".spec.parameters[0]", false, false)
+			pages, err := cmd.LoadPages(pagesFile)
+			Expect(err).NotTo(HaveOccurred())
+			module.SplitBy = cmd.SplitByFile
+			module.Pages = pages
+			Expect(cmd.Process(context.Background(), module)).To(Succeed())
+		})
+
+		It("should render the grouped variables on their pages", func() {
+			generatedData, err := os.ReadFile(fmt.Sprintf("%s/input.yaml", outputDir))
+			Expect(err).NotTo(HaveOccurred())
+			expectedData, err := os.ReadFile(expectedTemplateWithFilePages)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(generatedData).To(MatchYAML(expectedData))
+		})
+	})
+
+	Context("with the tfvars-pr step profile", func() {
+		BeforeEach(func() {
+			module := cmd.NewTerraformModule(inputDirWithRequire, outputDir, targetTemplateFile, ".spec.parameters[0]", false, false)
+			module.Steps = cmd.StepProfileTFVarsPR
+			Expect(cmd.Process(context.Background(), module)).To(Succeed())
+		})
+
+		It("should generate steps writing every variable to a tfvars file", func() {
+			generatedData, err := os.ReadFile(fmt.Sprintf("%s/input-require.yaml", outputDir))
+			Expect(err).NotTo(HaveOccurred())
+			expectedData, err := os.ReadFile(expectedTemplateWithTFVarsSteps)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(generatedData).To(MatchYAML(expectedData))
+		})
+	})
+
+	Context("with template metadata overrides", func() {
+		It("should render the metadata for each module", func() {
+			module := cmd.NewTerraformModule(inputDirWithRequire, outputDir, targetTemplateFile, ".spec.parameters[0]", false, false)
+			module.TemplateName = "{{.Module}}-tf"
+			module.TemplateDescription = "Provision the {{.Module}} module"
+			module.TemplateTags = []string{"terraform", "{{.Module}}"}
+			module.TemplateOwner = "platform-team"
+			Expect(cmd.Process(context.Background(), module)).To(Succeed())
+
+			generatedData, err := os.ReadFile(fmt.Sprintf("%s/input-require.yaml", outputDir))
+			Expect(err).NotTo(HaveOccurred())
+			var template struct {
+				Metadata struct {
+					Name        string   `json:"name"`
+					Title       string   `json:"title"`
+					Description string   `json:"description"`
+					Tags        []string `json:"tags"`
+				} `json:"metadata"`
+				Spec struct {
+					Owner string `json:"owner"`
+				} `json:"spec"`
+			}
+			Expect(yaml.Unmarshal(generatedData, &template)).To(Succeed())
+			Expect(template.Metadata.Name).To(Equal("input-require-tf"))
+			Expect(template.Metadata.Title).To(Equal("input-require"))
+			Expect(template.Metadata.Description).To(Equal("Provision the input-require module"))
+			Expect(template.Metadata.Tags).To(Equal([]string{"terraform", "input-require"}))
+			Expect(template.Spec.Owner).To(Equal("platform-team"))
+		})
+
+		It("should fail on values that are not available", func() {
+			module := cmd.NewTerraformModule(inputDirWithRequire, outputDir, targetTemplateFile, ".spec.parameters[0]", false, false)
+			module.TemplateName = "{{.Cluster}}"
+			Expect(cmd.Process(context.Background(), module)).NotTo(Succeed())
+		})
+	})
+
+	Context("with nested, tuple and optional types", func() {
+		It("should generate the schema of every type", func() {
+			Expect(cmd.Process(context.Background(), cmd.NewTerraformModule(typesInputDir, outputDir, "", "", false, true))).To(Succeed())
+
+			generatedData, err := os.ReadFile(fmt.Sprintf("%s/input.yaml", outputDir))
+			Expect(err).NotTo(HaveOccurred())
+			expectedData, err := os.ReadFile(expectedPropertyFileWithTypes)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(generatedData).To(MatchYAML(expectedData))
+		})
+
+		It("should mark sets with the uniqueItems key", func() {
+			Expect(cmd.Process(context.Background(), cmd.NewTerraformModule(typesInputDir, outputDir, "", "", false, true))).To(Succeed())
+
+			generatedData, err := os.ReadFile(fmt.Sprintf("%s/input.yaml", outputDir))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(generatedData)).To(ContainSubstring("uniqueItems: true"))
+			Expect(string(generatedData)).NotTo(ContainSubstring("uniqueitems"))
+		})
+
+		It("should nest the attributes of objects under properties", func() {
+			Expect(cmd.Process(context.Background(), cmd.NewTerraformModule(typesInputDir, outputDir, "", "", false, true))).To(Succeed())
+
+			generatedData, err := os.ReadFile(fmt.Sprintf("%s/input.yaml", outputDir))
+			Expect(err).NotTo(HaveOccurred())
+			var template struct {
+				Properties map[string]struct {
+					Properties map[string]any `json:"properties"`
+				} `json:"properties"`
+			}
+			Expect(yaml.Unmarshal(generatedData, &template)).To(Succeed())
+			Expect(template.Properties["cluster"].Properties).To(HaveKey("name"))
+			Expect(template.Properties["cluster"].Properties).To(HaveKey("logging"))
+			Expect(string(generatedData)).NotTo(ContainSubstring("UiWidget"))
+		})
+	})
+
+	Context("with variable validations", func() {
+		It("should translate the conditions into schema constraints", func() {
+			Expect(cmd.Process(context.Background(), cmd.NewTerraformModule(validationInputDir, outputDir, "", "", false, true))).To(Succeed())
+
+			generatedData, err := os.ReadFile(fmt.Sprintf("%s/input.yaml", outputDir))
+			Expect(err).NotTo(HaveOccurred())
+			expectedData, err := os.ReadFile(expectedPropertyFileWithRules)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(generatedData).To(MatchYAML(expectedData))
+		})
+	})
+
+	Context("with sensitive and nullable variables", func() {
+		It("should render sensitive variables as password fields without defaults", func() {
+			Expect(cmd.Process(context.Background(), cmd.NewTerraformModule(sensitiveInputDir, outputDir, "", "", false, true))).To(Succeed())
+
+			generatedData, err := os.ReadFile(fmt.Sprintf("%s/input.yaml", outputDir))
+			Expect(err).NotTo(HaveOccurred())
+			expectedData, err := os.ReadFile(expectedSensitivePropertyFile)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(generatedData).To(MatchYAML(expectedData))
+		})
+
+		It("should ask for secret references and pass them to terraform as environment variables", func() {
+			module := cmd.NewTerraformModule(sensitiveInputDir, outputDir, targetTemplateFile, ".spec.parameters[0]", false, false)
+			module.SensitiveMode = cmd.SensitiveSecretRef
+			module.Steps = cmd.StepProfileTFVarsPR
+			Expect(cmd.Process(context.Background(), module)).To(Succeed())
+
+			generatedData, err := os.ReadFile(fmt.Sprintf("%s/input.yaml", outputDir))
+			Expect(err).NotTo(HaveOccurred())
+			expectedData, err := os.ReadFile(expectedSecretRefTemplateFile)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(generatedData).To(MatchYAML(expectedData))
+		})
+
+		It("should reject the tfvars-pr steps for sensitive values asked as passwords", func() {
+			module := cmd.NewTerraformModule(sensitiveInputDir, outputDir, targetTemplateFile, ".spec.parameters[0]", false, false)
+			module.Steps = cmd.StepProfileTFVarsPR
+			err := cmd.Process(context.Background(), module)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("sensitive variables api_token, db_password"))
+		})
+	})
+
+	Context("with object defaults enabled", func() {
+		It("should set the defaults of object attributes and maps", func() {
+			module := cmd.NewTerraformModule(defaultsInputDir, outputDir, "", "", false, true)
+			module.ObjectDefaults = true
+			Expect(cmd.Process(context.Background(), module)).To(Succeed())
+
+			generatedData, err := os.ReadFile(fmt.Sprintf("%s/input.yaml", outputDir))
+			Expect(err).NotTo(HaveOccurred())
+			expectedData, err := os.ReadFile(expectedObjectDefaultsFile)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(generatedData).To(MatchYAML(expectedData))
+		})
+	})
+
+	Context("with module info enabled", func() {
+		BeforeEach(func() {
+			module := cmd.NewTerraformModule(moduleInfoInputDir, outputDir, targetTemplateFile, ".spec.parameters[0]", false, false)
+			module.ModuleInfo = true
+			module.CatalogInfo = true
+			Expect(cmd.Process(context.Background(), module)).To(Succeed())
+		})
+
+		It("should write outputs, providers and module calls next to the template", func() {
+			generatedData, err := os.ReadFile(fmt.Sprintf("%s/input.module.yaml", outputDir))
+			Expect(err).NotTo(HaveOccurred())
+			expectedData, err := os.ReadFile(expectedModuleInfoFile)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(generatedData).To(MatchYAML(expectedData))
+		})
+
+		It("should describe the template with the module README", func() {
+			generatedData, err := os.ReadFile(fmt.Sprintf("%s/input.yaml", outputDir))
+			Expect(err).NotTo(HaveOccurred())
+			expectedData, err := os.ReadFile(expectedModuleInfoTemplateFile)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(generatedData).To(MatchYAML(expectedData))
+		})
+
+		It("should not list the module info as a template", func() {
+			location, err := os.ReadFile(filepath.Join(outputDir, cmd.CatalogInfoFile))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(location)).To(ContainSubstring("./input.yaml"))
+			Expect(string(location)).NotTo(ContainSubstring("module.yaml"))
+		})
+	})
+
+	Context("with insertions", func() {
+		It("should insert every fragment at its own path with its merge", func() {
+			module := cmd.NewTerraformModule(inputDirWithRequire, outputDir, insertionsTemplateFile, ".spec.parameters[0]", false, false)
+			module.Steps = "tfvars-pr"
+			module.TemplateOwner = "platform-team"
+			var err error
+			module.Insertions, err = cmd.LoadInsertions(insertionsFile)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(cmd.Process(context.Background(), module)).To(Succeed())
+
+			generatedData, err := os.ReadFile(filepath.Join(outputDir, "input-require.yaml"))
+			Expect(err).NotTo(HaveOccurred())
+			expectedData, err := os.ReadFile(expectedInsertionsTemplateFile)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(generatedData).To(MatchYAML(expectedData))
+		})
+
+		It("should reject unknown fragments and merges", func() {
+			for _, content := range []string{
+				"insertions:\n  - fragment: title\n    path: .metadata.title\n",
+				"insertions:\n  - fragment: steps\n    path: .spec.steps\n    merge: union\n",
+				"insertions:\n  - fragment: steps\n    path: .spec.steps[\n",
+			} {
+				file := filepath.Join(tempDir, "insertions.yaml")
+				Expect(os.WriteFile(file, []byte(content), 0644)).To(Succeed())
+				_, err := cmd.LoadInsertions(file)
+				Expect(err).To(HaveOccurred())
+			}
+		})
+	})
+
+	Context("with module sources", func() {
+		It("should generate templates for fetched modules", func() {
+			fetcher := &libfakes.FakeIModuleFetcher{}
+			fetcher.FetchReturns(inputDirWithRequire, nil)
+			module := cmd.NewTerraformModule("", outputDir, "", "", false, true)
+			module.Sources = []string{"app.terraform.io/example/network/aws@1.0.0"}
+			module.Fetcher = fetcher
+			module.Index = true
+			Expect(cmd.Process(context.Background(), module)).To(Succeed())
+
+			Expect(fetcher.FetchCallCount()).To(Equal(1))
+			_, source := fetcher.FetchArgsForCall(0)
+			Expect(source.Type).To(Equal(lib.SourceRegistry))
+			Expect(source.Host).To(Equal("app.terraform.io"))
+			Expect(source.Namespace).To(Equal("example"))
+			Expect(source.Name).To(Equal("network"))
+			Expect(source.Provider).To(Equal("aws"))
+			Expect(source.Version).To(Equal("1.0.0"))
+
+			generatedData, err := os.ReadFile(fmt.Sprintf("%s/network.yaml", outputDir))
+			Expect(err).NotTo(HaveOccurred())
+			expectedData, err := os.ReadFile(expectedPropertyFileWithRequire)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(generatedData).To(MatchYAML(expectedData))
+
+			index, err := os.ReadFile(filepath.Join(outputDir, cmd.IndexFile))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(index)).To(ContainSubstring("source: app.terraform.io/example/network/aws@1.0.0"))
+		})
+
+		It("should use cached registry modules when offline", func() {
+			module := cmd.NewTerraformModule("", outputDir, "", "", false, true)
+			module.Sources = []string{"example/network/aws@1.0.0"}
+			module.Fetcher = lib.NewModuleFetcher(moduleCacheDir, true)
+			Expect(cmd.Process(context.Background(), module)).To(Succeed())
+
+			generatedData, err := os.ReadFile(fmt.Sprintf("%s/network.yaml", outputDir))
+			Expect(err).NotTo(HaveOccurred())
+			expectedData, err := os.ReadFile(expectedPropertyFileWithRequire)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(generatedData).To(MatchYAML(expectedData))
+		})
+
+		It("should use the latest cached version of registry modules without a version when offline", func() {
+			module := cmd.NewTerraformModule("", outputDir, "", "", false, true)
+			module.Sources = []string{"example/network/aws"}
+			module.Fetcher = lib.NewModuleFetcher(moduleCacheDir, true)
+			Expect(cmd.Process(context.Background(), module)).To(Succeed())
+
+			generatedData, err := os.ReadFile(fmt.Sprintf("%s/network.yaml", outputDir))
+			Expect(err).NotTo(HaveOccurred())
+			expectedData, err := os.ReadFile(expectedPropertyFileWithRequire)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(generatedData).To(MatchYAML(expectedData))
+		})
+
+		It("should fail for modules missing from the cache when offline", func() {
+			module := cmd.NewTerraformModule("", outputDir, "", "", false, true)
+			module.Sources = []string{"example/network/aws@2.0.0"}
+			module.Fetcher = lib.NewModuleFetcher(moduleCacheDir, true)
+			Expect(cmd.Process(context.Background(), module)).NotTo(Succeed())
+		})
+
+		It("should extract archives into the cache", func() {
+			module := cmd.NewTerraformModule("", outputDir, "", "", false, true)
+			module.Sources = []string{moduleArchive + "//network"}
+			module.Fetcher = lib.NewModuleFetcher(filepath.Join(tempDir, "cache"), false)
+			Expect(cmd.Process(context.Background(), module)).To(Succeed())
+
+			generatedData, err := os.ReadFile(fmt.Sprintf("%s/network.yaml", outputDir))
+			Expect(err).NotTo(HaveOccurred())
+			expectedData, err := os.ReadFile(expectedPropertyFileWithRequire)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(generatedData).To(MatchYAML(expectedData))
+		})
+
+		It("should reject archive entries outside of the target directory", func() {
+			archive := filepath.Join(tempDir, "evil.zip")
+			f, err := os.Create(archive)
+			Expect(err).NotTo(HaveOccurred())
+			w := zip.NewWriter(f)
+			entry, err := w.Create("../../evil.tf")
+			Expect(err).NotTo(HaveOccurred())
+			_, err = entry.Write([]byte("variable \"evil\" {}\n"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(w.Close()).To(Succeed())
+			Expect(f.Close()).To(Succeed())
+
+			source, err := lib.ParseModuleSource(archive)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = lib.NewModuleFetcher(filepath.Join(tempDir, "cache"), false).Fetch(context.Background(), source)
+			Expect(err).To(MatchError(ContainSubstring("outside of the target directory")))
+			matches, err := filepath.Glob(filepath.Join(tempDir, "*", "evil.tf"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(matches).To(BeEmpty())
+			Expect(filepath.Join(tempDir, "evil.tf")).NotTo(BeAnExistingFile())
+		})
+
+		DescribeTable("parsing git and archive sources",
+			func(address string, expected lib.ModuleSource) {
+				expected.Address = address
+				Expect(lib.ParseModuleSource(address)).To(Equal(expected))
+			},
+			Entry("forced git", "git::https://example.com/network.git?ref=v1.2.0",
+				lib.ModuleSource{Type: lib.SourceGit, URL: "https://example.com/network.git", Ref: "v1.2.0"}),
+			Entry("forced git with a subdirectory", "git::https://example.com/network.git//modules/vpc?ref=v1.2.0",
+				lib.ModuleSource{Type: lib.SourceGit, URL: "https://example.com/network.git", Ref: "v1.2.0", Subdir: "modules/vpc"}),
+			Entry("known git host", "github.com/example/network?ref=main",
+				lib.ModuleSource{Type: lib.SourceGit, URL: "https://github.com/example/network", Ref: "main"}),
+			Entry("scp-like git", "git@github.com:example/network.git",
+				lib.ModuleSource{Type: lib.SourceGit, URL: "git@github.com:example/network.git"}),
+			Entry("git over https", "https://example.com/network.git",
+				lib.ModuleSource{Type: lib.SourceGit, URL: "https://example.com/network.git"}),
+			Entry("zip archive", "https://example.com/network.zip",
+				lib.ModuleSource{Type: lib.SourceArchive, URL: "https://example.com/network.zip"}),
+			Entry("archive with a subdirectory", "https://example.com/network.tgz//modules/vpc",
+				lib.ModuleSource{Type: lib.SourceArchive, URL: "https://example.com/network.tgz", Subdir: "modules/vpc"}),
+			Entry("archive format in the query", "https://example.com/download?archive=tar.gz",
+				lib.ModuleSource{Type: lib.SourceArchive, URL: "https://example.com/download?archive=tar.gz"}),
+			Entry("local archive", "./modules/network.tar.gz",
+				lib.ModuleSource{Type: lib.SourceArchive, URL: "./modules/network.tar.gz"}),
+		)
+
+		It("should reject git sources that would be taken for options", func() {
+			for _, address := range []string{
+				"git::--upload-pack=touch evil",
+				"git::https://example.com/network.git?ref=--upload-pack=touch",
+			} {
+				_, err := lib.ParseModuleSource(address)
+				Expect(err).To(HaveOccurred(), address)
+			}
+
+			module := cmd.NewTerraformModule("", outputDir, "", "", false, true)
+			module.Sources = []string{"git::--upload-pack=touch " + filepath.Join(tempDir, "evil")}
+			module.Fetcher = lib.NewModuleFetcher(filepath.Join(tempDir, "cache"), false)
+			Expect(cmd.Process(context.Background(), module)).NotTo(Succeed())
+			Expect(filepath.Join(tempDir, "evil")).NotTo(BeAnExistingFile())
+		})
+
+		It("should reject http sources that are neither git repositories nor archives", func() {
+			_, err := lib.ParseModuleSource("https://example.com/network")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("with dry run enabled", func() {
+		var out *gbytes.Buffer
+
+		newModule := func() *cmd.TerraformModule {
+			module := cmd.NewTerraformModule(validInputRootDir, outputDir, "", "", false, true)
+			module.DryRun = true
+			module.Out = out
+			return module
+		}
+
+		BeforeEach(func() {
+			out = gbytes.NewBuffer()
+		})
+
+		It("should report the files to create without writing them", func() {
+			Expect(cmd.Process(context.Background(), newModule())).To(MatchError(cmd.ErrOutputChanged))
+			Expect(out).To(gbytes.Say(`create\s+input-require\.yaml`))
+			Expect(out).To(gbytes.Say(`create\s+input\.yaml`))
+
+			files, err := readOutputDir(outputDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(files).To(BeEmpty())
+		})
+
+		It("should succeed when the output is up to date", func() {
+			Expect(cmd.Process(context.Background(), cmd.NewTerraformModule(validInputRootDir, outputDir, "", "", false, true))).To(Succeed())
+
+			Expect(cmd.Process(context.Background(), newModule())).To(Succeed())
+			Expect(out).To(gbytes.Say("no changes"))
+		})
+
+		It("should list files it did not generate without counting them as changes", func() {
+			Expect(cmd.Process(context.Background(), cmd.NewTerraformModule(validInputRootDir, outputDir, "", "", false, true))).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(outputDir, "kustomization.yaml"), []byte("resources: []\n"), 0644)).To(Succeed())
+
+			Expect(cmd.Process(context.Background(), newModule())).To(Succeed())
+			Expect(out).To(gbytes.Say(`untracked kustomization\.yaml`))
+			Expect(out).To(gbytes.Say("no changes"))
+			Expect(filepath.Join(outputDir, "kustomization.yaml")).To(BeAnExistingFile())
+		})
+
+		It("should report changed values and stale files with diff", func() {
+			Expect(cmd.Process(context.Background(), cmd.NewTerraformModule(validInputRootDir, outputDir, "", "", false, true))).To(Succeed())
+			edited, err := os.ReadFile(expectedPropertyFile)
+			Expect(err).NotTo(HaveOccurred())
+			var content map[string]any
+			Expect(yaml.Unmarshal(edited, &content)).To(Succeed())
+			props := content["properties"].(map[string]any)
+			props["name"].(map[string]any)["default"] = "edited"
+			delete(props, "eks_cluster_version")
+			edited, err = yaml.Marshal(content)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(os.WriteFile(filepath.Join(outputDir, "input.yaml"), edited, 0644)).To(Succeed())
+			Expect(os.WriteFile(filepath.Join(outputDir, "stale.yaml"), []byte("properties: {}\n"), 0644)).To(Succeed())
+
+			module := newModule()
+			module.Diff = true
+			Expect(cmd.Process(context.Background(), module)).To(MatchError(cmd.ErrOutputChanged))
+			Expect(out).To(gbytes.Say(`change\s+input\.yaml`))
+			Expect(out).To(gbytes.Say(`\+ \.properties\.eks_cluster_version: \{.*\}`))
+			Expect(out).To(gbytes.Say(`~ \.properties\.name\.default: "edited" -> "emr-eks-ack"`))
+			Expect(out).To(gbytes.Say(`untracked stale\.yaml`))
+
+			data, err := os.ReadFile(filepath.Join(outputDir, "input.yaml"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(data).To(MatchYAML(edited))
+		})
+	})
+
+	Context("with merging of hand edits enabled", func() {
+		var (
+			moduleDir string
+			generated string
+		)
+
+		process := func() error {
+			module := cmd.NewTerraformModule(moduleDir, outputDir, "", "", false, true)
+			module.Merge = true
+			return cmd.Process(context.Background(), module)
+		}
+
+		// edit changes the generated file like a user would
+		edit := func(change func(props map[string]any)) {
+			data, err := os.ReadFile(generated)
+			Expect(err).NotTo(HaveOccurred())
+			var content map[string]any
+			Expect(yaml.Unmarshal(data, &content)).To(Succeed())
+			change(content["properties"].(map[string]any))
+			data, err = yaml.Marshal(content)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(os.WriteFile(generated, data, 0644)).To(Succeed())
+		}
+
+		// regenerate changes the description of the name variable in the module
+		regenerate := func() error {
+			variables := filepath.Join(moduleDir, "variables.tf")
+			data, err := os.ReadFile(variables)
+			Expect(err).NotTo(HaveOccurred())
+			data = []byte(strings.Replace(string(data), "Name of the VPC and EKS Cluster", "Name of the cluster", 1))
+			Expect(os.WriteFile(variables, data, 0644)).To(Succeed())
+			return process()
+		}
+
+		readProperty := func(name string) map[string]any {
+			data, err := os.ReadFile(generated)
+			Expect(err).NotTo(HaveOccurred())
+			var content map[string]any
+			Expect(yaml.Unmarshal(data, &content)).To(Succeed())
+			return content["properties"].(map[string]any)[name].(map[string]any)
+		}
+
+		BeforeEach(func() {
+			moduleDir = filepath.Join(tempDir, "network")
+			Expect(os.MkdirAll(moduleDir, 0755)).To(Succeed())
+			for _, f := range []string{"main.tf", "variables.tf"} {
+				data, err := os.ReadFile(filepath.Join(inputDir, f))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(os.WriteFile(filepath.Join(moduleDir, f), data, 0644)).To(Succeed())
+			}
+			generated = filepath.Join(outputDir, "network.yaml")
+			Expect(process()).To(Succeed())
+		})
+
+		It("should record the generated file as the merge base", func() {
+			base, err := os.ReadFile(filepath.Join(outputDir, cmd.MergeBaseDir, "network.yaml"))
+			Expect(err).NotTo(HaveOccurred())
+			expectedData, err := os.ReadFile(expectedPropertyFile)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(base).To(MatchYAML(expectedData))
+		})
+
+		It("should keep hand edits and update generated values", func() {
+			edit(func(props map[string]any) {
+				props["name"].(map[string]any)["ui:widget"] = "textarea"
+				props["eks_cluster_version"].(map[string]any)["default"] = "1.28"
+				delete(props, "public_subnets")
+			})
+			Expect(regenerate()).To(Succeed())
+
+			name := readProperty("name")
+			Expect(name).To(HaveKeyWithValue("ui:widget", "textarea"))
+			Expect(name).To(HaveKeyWithValue("description", "Name of the cluster"))
+			Expect(readProperty("eks_cluster_version")).To(HaveKeyWithValue("default", "1.28"))
+
+			data, err := os.ReadFile(generated)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(data)).NotTo(ContainSubstring("public_subnets"))
+		})
+
+		It("should report conflicting edits and leave the file unchanged", func() {
+			edit(func(props map[string]any) {
+				props["name"].(map[string]any)["description"] = "Name of the environment"
+			})
+			edited, err := os.ReadFile(generated)
+			Expect(err).NotTo(HaveOccurred())
+
+			err = regenerate()
+			Expect(err).To(MatchError(cmd.ErrMergeConflict))
+			Expect(err).To(MatchError(ContainSubstring("network.yaml")))
+			Expect(stdout).To(gbytes.Say(`! \.properties\.name\.description: "Name of the environment" <> "Name of the cluster"`))
+
+			data, err := os.ReadFile(generated)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(data).To(Equal(edited))
+		})
+
+		It("should fail for edited files that cannot be parsed", func() {
+			broken := []byte("properties: [\n")
+			Expect(os.WriteFile(generated, broken, 0644)).To(Succeed())
+
+			err := regenerate()
+			Expect(err).To(MatchError(ContainSubstring("failed to write")))
+			Expect(err).To(MatchError(ContainSubstring("network.yaml")))
+
+			data, err := os.ReadFile(generated)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(data).To(Equal(broken))
+		})
+	})
+
+	Context("with several modules processed in parallel", func() {
+		var modulesDir string
+
+		BeforeEach(func() {
+			modulesDir = filepath.Join(tempDir, "modules")
+			for name, dir := range map[string]string{
+				"a-invalid": "./fakes/terraform/invalid/input",
+				"b-input":   inputDir,
+				"c-require": inputDirWithRequire,
+				"d-types":   typesInputDir,
+			} {
+				Expect(os.MkdirAll(filepath.Join(modulesDir, name), 0755)).To(Succeed())
+				files, err := os.ReadDir(dir)
+				Expect(err).NotTo(HaveOccurred())
+				for _, f := range files {
+					data, err := os.ReadFile(filepath.Join(dir, f.Name()))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(os.WriteFile(filepath.Join(modulesDir, name, f.Name()), data, 0644)).To(Succeed())
+				}
+			}
+		})
+
+		It("should write the other modules and report the failures at the end", func() {
+			module := cmd.NewTerraformModule(modulesDir, outputDir, "", "", false, true)
+			module.Workers = 4
+			module.Index = true
+			err := cmd.Process(context.Background(), module)
+			Expect(err).To(MatchError(ContainSubstring("a-invalid")))
+
+			for file, expected := range map[string]string{
+				"b-input.yaml":   expectedPropertyFile,
+				"c-require.yaml": expectedPropertyFileWithRequire,
+				"d-types.yaml":   expectedPropertyFileWithTypes,
+			} {
+				generatedData, err := os.ReadFile(filepath.Join(outputDir, file))
+				Expect(err).NotTo(HaveOccurred())
+				expectedData, err := os.ReadFile(expected)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(generatedData).To(MatchYAML(expectedData))
+			}
+
+			index, err := os.ReadFile(filepath.Join(outputDir, cmd.IndexFile))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(index)).To(MatchRegexp(`(?s)b-input\.yaml.*c-require\.yaml.*d-types\.yaml`))
+		})
+
+		It("should stop at the first failure with fail fast", func() {
+			module := cmd.NewTerraformModule(modulesDir, outputDir, "", "", false, true)
+			module.FailFast = true
+			Expect(cmd.Process(context.Background(), module)).NotTo(Succeed())
+
+			files, err := readOutputDir(outputDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(files).To(BeEmpty())
+		})
+
+		It("should not process definitions once the context is cancelled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			module := cmd.NewTerraformModule(modulesDir, outputDir, "", "", false, true)
+			module.Workers = 2
+			Expect(cmd.Process(ctx, module)).To(MatchError(context.Canceled))
+
+			files, err := readOutputDir(outputDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(files).To(BeEmpty())
+		})
+	})
 })
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/terraform-config-inspect/tfconfig"
+)
+
+const moduleInfoSuffix = ".module.yaml"
+
+var readmeFiles = []string{"README.md", "readme.md", "README.markdown", "README"}
+
+// moduleInfo describes what a module provisions, so outputs can be wired into later steps and provider requirements
+// shown to users. It is written next to the generated template.
+type moduleInfo struct {
+	Name              string                `yaml:"name"`
+	Source            string                `yaml:"source,omitempty"`
+	Description       string                `yaml:"description,omitempty"`
+	RequiredCore      []string              `yaml:"requiredCore,omitempty"`
+	RequiredProviders []moduleInfoProvider  `yaml:"requiredProviders,omitempty"`
+	Outputs           []moduleInfoOutput    `yaml:"outputs,omitempty"`
+	Modules           []moduleInfoModuleRef `yaml:"modules,omitempty"`
+}
+
+type moduleInfoProvider struct {
+	Name    string   `yaml:"name"`
+	Source  string   `yaml:"source,omitempty"`
+	Version []string `yaml:"version,omitempty"`
+}
+
+type moduleInfoOutput struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description,omitempty"`
+	Sensitive   bool   `yaml:"sensitive,omitempty"`
+}
+
+type moduleInfoModuleRef struct {
+	Name    string `yaml:"name"`
+	Source  string `yaml:"source"`
+	Version string `yaml:"version,omitempty"`
+}
+
+func newModuleInfo(mod *tfconfig.Module, name, source, description string) moduleInfo {
+	info := moduleInfo{
+		Name:         name,
+		Source:       source,
+		Description:  description,
+		RequiredCore: mod.RequiredCore,
+	}
+	for _, k := range sortedKeys(mod.RequiredProviders) {
+		p := mod.RequiredProviders[k]
+		info.RequiredProviders = append(info.RequiredProviders, moduleInfoProvider{
+			Name:    k,
+			Source:  p.Source,
+			Version: p.VersionConstraints,
+		})
+	}
+	for _, k := range sortedKeys(mod.Outputs) {
+		o := mod.Outputs[k]
+		info.Outputs = append(info.Outputs, moduleInfoOutput{
+			Name:        k,
+			Description: o.Description,
+			Sensitive:   o.Sensitive,
+		})
+	}
+	for _, k := range sortedKeys(mod.ModuleCalls) {
+		c := mod.ModuleCalls[k]
+		info.Modules = append(info.Modules, moduleInfoModuleRef{
+			Name:    k,
+			Source:  c.Source,
+			Version: c.Version,
+		})
+	}
+	return info
+}
+
+// readmeDescription returns the first paragraph of the module README that is not a heading, badge or HTML.
+func readmeDescription(dir string) string {
+	for _, name := range readmeFiles {
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		defer f.Close()
+
+		lines := make([]string, 0)
+		inCode := false
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if strings.HasPrefix(line, "```") {
+				inCode = !inCode
+				continue
+			}
+			if inCode {
+				continue
+			}
+			if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "[![") ||
+				strings.HasPrefix(line, "![") || strings.HasPrefix(line, "<") {
+				if len(lines) > 0 {
+					break
+				}
+				continue
+			}
+			lines = append(lines, line)
+		}
+		return strings.Join(lines, " ")
+	}
+	return ""
+}
@@ -0,0 +1,181 @@
+package cmd
+
+import (
+	"encoding/json"
+	"log"
+	"sort"
+	"strconv"
+
+	"github.com/cnoe-io/cnoe-cli/pkg/models"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/ext/typeexpr"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/terraform-config-inspect/tfconfig"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// convertVariable returns the form field of a variable. Defaults of object and map types are only set with
+// objectDefaults, since the Backstage UI cannot remove them.
+func convertVariable(tfVar tfconfig.Variable, objectDefaults bool) models.BackstageParamFields {
+	ty, defaults, err := parseType(tfVar.Type)
+	if err != nil {
+		log.Printf("could not parse the type of variable %s, it will be rendered as a string: %s", tfVar.Name, err)
+		ty, defaults = cty.String, nil
+	}
+
+	out := convertType(tfVar.Name, ty, defaults, objectDefaults)
+	out.Description = tfVar.Description
+	if tfVar.Default != nil {
+		setDefault(out, tfVar.Default, objectDefaults)
+	}
+	return *out
+}
+
+// parseType parses a Terraform type constraint such as map(object({a = optional(string, "b")})).
+// Variables without a type accept any value.
+func parseType(s string) (cty.Type, *typeexpr.Defaults, error) {
+	if s == "" {
+		return cty.DynamicPseudoType, nil, nil
+	}
+	expr, diags := hclsyntax.ParseExpression([]byte(s), "", hcl.InitialPos)
+	if diags.HasErrors() {
+		return cty.NilType, nil, diags
+	}
+	ty, defaults, diags := typeexpr.TypeConstraintWithDefaults(expr)
+	if diags.HasErrors() {
+		return cty.NilType, nil, diags
+	}
+	return ty, defaults, nil
+}
+
+// convertType returns the JSON schema of the given type. Defaults of optional object attributes are taken from
+// defaults, which may be nil.
+func convertType(name string, ty cty.Type, defaults *typeexpr.Defaults, objectDefaults bool) *models.BackstageParamFields {
+	switch {
+	case ty == cty.String:
+		return &models.BackstageParamFields{Type: "string"}
+	case ty == cty.Number:
+		return &models.BackstageParamFields{Type: "number"}
+	case ty == cty.Bool:
+		return &models.BackstageParamFields{Type: "boolean"}
+	case ty.IsListType(), ty.IsSetType():
+		out := &models.BackstageParamFields{
+			Type:  "array",
+			Items: convertType(name, ty.ElementType(), childDefaults(defaults, ""), objectDefaults),
+		}
+		if ty.IsSetType() {
+			u := true
+			out.UniqueItems = &u
+		}
+		return out
+	case ty.IsTupleType():
+		types := ty.TupleElementTypes()
+		items := make([]*models.BackstageParamFields, len(types))
+		for i := range types {
+			items[i] = convertType(name, types[i], childDefaults(defaults, strconv.Itoa(i)), objectDefaults)
+		}
+		n := len(types)
+		return &models.BackstageParamFields{
+			Type:     "array",
+			Items:    items,
+			MinItems: &n,
+			MaxItems: &n,
+		}
+	case ty.IsMapType():
+		return &models.BackstageParamFields{
+			Title:                name,
+			Type:                 "object",
+			AdditionalProperties: convertType(name, ty.ElementType(), childDefaults(defaults, ""), objectDefaults),
+		}
+	case ty.IsObjectType():
+		out := &models.BackstageParamFields{
+			Title:      name,
+			Type:       "object",
+			Properties: make(map[string]*models.BackstageParamFields),
+		}
+		for _, attr := range sortedAttributes(ty) {
+			p := convertType(attr, ty.AttributeType(attr), childDefaults(defaults, attr), objectDefaults)
+			if ty.AttributeOptional(attr) {
+				if v, ok := defaultValue(defaults, attr); ok {
+					setDefault(p, v, objectDefaults)
+				}
+			} else {
+				out.Required = append(out.Required, attr)
+			}
+			out.Properties[attr] = p
+		}
+		return out
+	default:
+		// any accepts values of every type, which a form can only collect as a string
+		return &models.BackstageParamFields{Type: "string"}
+	}
+}
+
+// setDefault sets the default value of a field. Object defaults are set on the attributes of the object where
+// possible, so users can still change single attributes.
+func setDefault(f *models.BackstageParamFields, value any, objectDefaults bool) {
+	if f.Type != "object" {
+		f.Default = value
+		return
+	}
+	// defaults for object type is broken in Backstage atm. In the UI, the default values cannot be removed.
+	if !objectDefaults {
+		return
+	}
+	values, ok := value.(map[string]any)
+	if !ok || len(f.Properties) == 0 {
+		f.Default = value
+		return
+	}
+	for k, v := range values {
+		if p, ok := f.Properties[k]; ok && v != nil {
+			setDefault(p, v, objectDefaults)
+		}
+	}
+}
+
+func childDefaults(defaults *typeexpr.Defaults, key string) *typeexpr.Defaults {
+	if defaults == nil {
+		return nil
+	}
+	return defaults.Children[key]
+}
+
+// defaultValue returns the default of an optional object attribute as a plain go value.
+func defaultValue(defaults *typeexpr.Defaults, attr string) (any, bool) {
+	if defaults == nil {
+		return nil, false
+	}
+	v, ok := defaults.DefaultValues[attr]
+	if !ok {
+		return nil, false
+	}
+	return goValue(v)
+}
+
+// goValue converts a known cty value to the go value it is represented by in JSON.
+func goValue(v cty.Value) (any, bool) {
+	if v.IsNull() || !v.IsWhollyKnown() {
+		return nil, false
+	}
+	b, err := ctyjson.Marshal(v, v.Type())
+	if err != nil {
+		return nil, false
+	}
+	var out any
+	if err := json.Unmarshal(b, &out); err != nil {
+		return nil, false
+	}
+	return out, true
+}
+
+func sortedAttributes(ty cty.Type) []string {
+	attrs := ty.AttributeTypes()
+	names := make([]string, 0, len(attrs))
+	for k := range attrs {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,309 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"strings"
+
+	"github.com/cnoe-io/cnoe-cli/pkg/models"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/terraform-config-inspect/tfconfig"
+	"github.com/zclconf/go-cty/cty"
+)
+
+const (
+	SensitivePassword  = "password"
+	SensitiveSecretRef = "secret-ref"
+)
+
+// variableBlock holds the parts of a Terraform variable declaration tfconfig does not expose.
+type variableBlock struct {
+	validations []variableValidation
+	// nullable is nil when not set, Terraform treats variables as nullable by default
+	nullable *bool
+}
+
+// variableValidation is a validation block of a Terraform variable.
+type variableValidation struct {
+	condition    hcl.Expression
+	errorMessage string
+}
+
+var (
+	variableBlockSchema = &hcl.BodySchema{
+		Blocks: []hcl.BlockHeaderSchema{{Type: "variable", LabelNames: []string{"name"}}},
+	}
+	variableBodySchema = &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{{Name: "nullable"}},
+		Blocks:     []hcl.BlockHeaderSchema{{Type: "validation"}},
+	}
+)
+
+// readVariableBlocks returns the variable blocks declared in the module at dir, keyed by variable name.
+// tfconfig does not expose validations and nullability, so the files are parsed again.
+func readVariableBlocks(dir string) (map[string]variableBlock, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.tf"))
+	if err != nil {
+		return nil, err
+	}
+	parser := hclparse.NewParser()
+	out := make(map[string]variableBlock)
+	for _, f := range files {
+		file, diags := parser.ParseHCLFile(f)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+		content, _, diags := file.Body.PartialContent(variableBlockSchema)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+		for _, variable := range content.Blocks {
+			name := variable.Labels[0]
+			body, _, diags := variable.Body.PartialContent(variableBodySchema)
+			if diags.HasErrors() {
+				return nil, diags
+			}
+			b := out[name]
+			if attr, ok := body.Attributes["nullable"]; ok {
+				if v, ok := literal(attr.Expr); ok && v.Type() == cty.Bool {
+					nullable := v.True()
+					b.nullable = &nullable
+				}
+			}
+			for _, block := range body.Blocks {
+				attrs, diags := block.Body.JustAttributes()
+				if diags.HasErrors() {
+					return nil, diags
+				}
+				condition, ok := attrs["condition"]
+				if !ok {
+					continue
+				}
+				v := variableValidation{condition: condition.Expr}
+				if msg, ok := attrs["error_message"]; ok {
+					if s, ok := literalString(msg.Expr); ok {
+						v.errorMessage = s
+					}
+				}
+				b.validations = append(b.validations, v)
+			}
+			out[name] = b
+		}
+	}
+	return out, nil
+}
+
+// required reports whether a value must be given for the variable. Variables without a default are required, and so
+// are variables that cannot be null but default to null.
+func (b variableBlock) required(tfVar tfconfig.Variable) bool {
+	if tfVar.Required {
+		return true
+	}
+	return b.nullable != nil && !*b.nullable && tfVar.Default == nil
+}
+
+// sensitiveField renders a sensitive variable without its default and hides its value in the review step. In secret
+// reference mode it is replaced by the name and key of the Kubernetes secret holding the value.
+func (t *TerraformModule) sensitiveField(name string, f models.BackstageParamFields) models.BackstageParamFields {
+	if t.SensitiveMode == SensitiveSecretRef {
+		description := fmt.Sprintf("Kubernetes secret holding the value of %s", name)
+		if f.Description != "" {
+			description = fmt.Sprintf("%s. %s", f.Description, description)
+		}
+		return models.BackstageParamFields{
+			Title:       name,
+			Type:        "object",
+			Description: description,
+			Properties: map[string]*models.BackstageParamFields{
+				"name": {Type: "string", Description: "name of the secret"},
+				"key":  {Type: "string", Description: "key of the value within the secret"},
+			},
+			Required: []string{"name", "key"},
+		}
+	}
+	f.Default = nil
+	if f.Type == "string" {
+		f.UIWidget = "password"
+	}
+	f.UIBackstage = map[string]any{"review": map[string]any{"show": false}}
+	return f
+}
+
+// applyValidations translates common validation conditions into JSON schema constraints of the field. Conditions
+// that cannot be expressed are left to Terraform, but their error messages are still shown as help.
+func applyValidations(name string, f *models.BackstageParamFields, validations []variableValidation) {
+	messages := make([]string, 0, len(validations))
+	for _, v := range validations {
+		addConstraints(name, f, v.condition)
+		if v.errorMessage != "" {
+			messages = append(messages, v.errorMessage)
+		}
+	}
+	if len(messages) > 0 && f.UIHelp == "" {
+		f.UIHelp = strings.Join(messages, " ")
+	}
+}
+
+func addConstraints(name string, f *models.BackstageParamFields, expr hcl.Expression) {
+	switch e := expr.(type) {
+	case *hclsyntax.ParenthesesExpr:
+		addConstraints(name, f, e.Expression)
+	case *hclsyntax.BinaryOpExpr:
+		if e.Op == hclsyntax.OpLogicalAnd {
+			addConstraints(name, f, e.LHS)
+			addConstraints(name, f, e.RHS)
+			return
+		}
+		addComparison(name, f, e)
+	case *hclsyntax.FunctionCallExpr:
+		switch {
+		// contains(["a", "b"], var.x)
+		case e.Name == "contains" && len(e.Args) == 2 && isVariable(e.Args[1], name):
+			if values, ok := literalList(e.Args[0]); ok {
+				f.Enum = values
+			}
+		// can(regex("^[a-z]+$", var.x))
+		case e.Name == "can" && len(e.Args) == 1:
+			if call, ok := unwrap(e.Args[0]).(*hclsyntax.FunctionCallExpr); ok &&
+				call.Name == "regex" && len(call.Args) == 2 && isVariable(call.Args[1], name) {
+				if pattern, ok := literalString(call.Args[0]); ok {
+					f.Pattern = pattern
+				}
+			}
+		}
+	}
+}
+
+// addComparison handles comparisons of the variable or its length against a number, e.g. length(var.x) <= 63.
+func addComparison(name string, f *models.BackstageParamFields, e *hclsyntax.BinaryOpExpr) {
+	subject, other, op := unwrap(e.LHS), unwrap(e.RHS), e.Op
+	n, ok := literalNumber(other)
+	if !ok {
+		// the number is on the left, e.g. 0 < var.x
+		subject, other = other, subject
+		if n, ok = literalNumber(other); !ok {
+			return
+		}
+		op = flipComparison(op)
+	}
+
+	if call, ok := subject.(*hclsyntax.FunctionCallExpr); ok &&
+		call.Name == "length" && len(call.Args) == 1 && isVariable(call.Args[0], name) {
+		lo, hi := &f.MinLength, &f.MaxLength
+		if f.Type == "array" {
+			lo, hi = &f.MinItems, &f.MaxItems
+		}
+		setLengthBounds(lo, hi, op, n)
+		return
+	}
+	if !isVariable(subject, name) || f.Type != "number" {
+		return
+	}
+	switch op {
+	case hclsyntax.OpGreaterThanOrEqual:
+		f.Minimum = &n
+	case hclsyntax.OpGreaterThan:
+		f.ExclusiveMinimum = &n
+	case hclsyntax.OpLessThanOrEqual:
+		f.Maximum = &n
+	case hclsyntax.OpLessThan:
+		f.ExclusiveMaximum = &n
+	case hclsyntax.OpEqual:
+		f.Minimum, f.Maximum = &n, &n
+	}
+}
+
+func setLengthBounds(lo, hi **int, op *hclsyntax.Operation, n float64) {
+	lower, upper := int(math.Ceil(n)), int(math.Floor(n))
+	switch op {
+	case hclsyntax.OpGreaterThanOrEqual:
+		*lo = &lower
+	case hclsyntax.OpGreaterThan:
+		lower = int(math.Floor(n)) + 1
+		*lo = &lower
+	case hclsyntax.OpLessThanOrEqual:
+		*hi = &upper
+	case hclsyntax.OpLessThan:
+		upper = int(math.Ceil(n)) - 1
+		*hi = &upper
+	case hclsyntax.OpEqual:
+		*lo, *hi = &lower, &upper
+	}
+}
+
+func flipComparison(op *hclsyntax.Operation) *hclsyntax.Operation {
+	switch op {
+	case hclsyntax.OpGreaterThan:
+		return hclsyntax.OpLessThan
+	case hclsyntax.OpGreaterThanOrEqual:
+		return hclsyntax.OpLessThanOrEqual
+	case hclsyntax.OpLessThan:
+		return hclsyntax.OpGreaterThan
+	case hclsyntax.OpLessThanOrEqual:
+		return hclsyntax.OpGreaterThanOrEqual
+	default:
+		return op
+	}
+}
+
+func unwrap(expr hcl.Expression) hcl.Expression {
+	if p, ok := expr.(*hclsyntax.ParenthesesExpr); ok {
+		return unwrap(p.Expression)
+	}
+	return expr
+}
+
+// isVariable reports whether expr is a reference to var.<name>.
+func isVariable(expr hcl.Expression, name string) bool {
+	t, ok := unwrap(expr).(*hclsyntax.ScopeTraversalExpr)
+	if !ok || len(t.Traversal) != 2 || t.Traversal.RootName() != "var" {
+		return false
+	}
+	attr, ok := t.Traversal[1].(hcl.TraverseAttr)
+	return ok && attr.Name == name
+}
+
+// literal evaluates expressions that do not refer to variables or functions.
+func literal(expr hcl.Expression) (cty.Value, bool) {
+	if len(expr.Variables()) > 0 {
+		return cty.NilVal, false
+	}
+	v, diags := expr.Value(nil)
+	if diags.HasErrors() || !v.IsWhollyKnown() || v.IsNull() {
+		return cty.NilVal, false
+	}
+	return v, true
+}
+
+func literalString(expr hcl.Expression) (string, bool) {
+	v, ok := literal(expr)
+	if !ok || v.Type() != cty.String {
+		return "", false
+	}
+	return v.AsString(), true
+}
+
+func literalNumber(expr hcl.Expression) (float64, bool) {
+	v, ok := literal(expr)
+	if !ok || v.Type() != cty.Number {
+		return 0, false
+	}
+	n, _ := v.AsBigFloat().Float64()
+	return n, true
+}
+
+func literalList(expr hcl.Expression) ([]any, bool) {
+	v, ok := literal(expr)
+	if !ok || !(v.Type().IsTupleType() || v.Type().IsListType() || v.Type().IsSetType()) {
+		return nil, false
+	}
+	out, ok := goValue(v)
+	if !ok {
+		return nil, false
+	}
+	values, ok := out.([]any)
+	return values, ok && len(values) > 0
+}
@@ -0,0 +1,330 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/cnoe-io/cnoe-cli/pkg/models"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	uiWidget      = "ui:widget"
+	uiField       = "ui:field"
+	uiHelp        = "ui:help"
+	uiPlaceholder = "ui:placeholder"
+	uiOrder       = "ui:order"
+	uiOptions     = "ui:options"
+)
+
+var (
+	defaultUIRules = models.UIRules{
+		HelpThreshold: 120,
+		SecretField:   "Secret",
+		Rules: []models.UIRule{
+			{Format: "password", Set: map[string]any{uiWidget: "password"}},
+		},
+	}
+
+	secretRefName = regexp.MustCompile(`(?i)secret(key)?ref$`)
+
+	// uiKeys are the ui:* keys rules can set.
+	uiKeys = map[string]bool{uiWidget: true, uiField: true, uiHelp: true, uiPlaceholder: true, uiOrder: true, uiOptions: true}
+)
+
+// LoadUIRules reads ui rules from the given file on top of the default rules.
+func LoadUIRules(path string) (*models.UIRules, error) {
+	rules := defaultUIRules
+	if path == "" {
+		return &rules, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var custom models.UIRules
+	err = yaml.Unmarshal(data, &custom)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ui rules file %s: %w", path, err)
+	}
+	if custom.HelpThreshold > 0 {
+		rules.HelpThreshold = custom.HelpThreshold
+	}
+	if custom.SecretField != "" {
+		rules.SecretField = custom.SecretField
+	}
+	rules.Rules = append(append([]models.UIRule{}, rules.Rules...), custom.Rules...)
+	if _, err := compileUIRules(&rules); err != nil {
+		return nil, err
+	}
+	return &rules, nil
+}
+
+type uiRule struct {
+	models.UIRule
+	name *regexp.Regexp
+}
+
+type uiRules struct {
+	helpThreshold int
+	secretField   string
+	rules         []uiRule
+}
+
+// compiledUIRules are the compiled form of the ui rules of a config.
+type compiledUIRules struct {
+	source *models.UIRules
+	rules  uiRules
+}
+
+// prepareUIRules compiles the ui rules of the config once so definitions do not compile them again.
+func (c *EntityConfig) prepareUIRules() error {
+	if c.UIRules == nil {
+		c.compiledUIRules = nil
+		return nil
+	}
+	rules, err := compileUIRules(c.UIRules)
+	if err != nil {
+		return err
+	}
+	c.compiledUIRules = &compiledUIRules{source: c.UIRules, rules: rules}
+	return nil
+}
+
+// uiHints returns the compiled ui rules of the config. Rules changed since they were prepared are compiled again.
+func (c EntityConfig) uiHints() (uiRules, error) {
+	if c.compiledUIRules != nil && c.compiledUIRules.source == c.UIRules {
+		return c.compiledUIRules.rules, nil
+	}
+	return compileUIRules(c.UIRules)
+}
+
+func compileUIRules(r *models.UIRules) (uiRules, error) {
+	out := uiRules{
+		helpThreshold: r.HelpThreshold,
+		secretField:   r.SecretField,
+	}
+	for _, rule := range r.Rules {
+		for _, k := range sortedKeys(rule.Set) {
+			if !uiKeys[k] {
+				return uiRules{}, fmt.Errorf("unsupported key %s in ui rule", k)
+			}
+		}
+		c := uiRule{UIRule: rule}
+		if rule.Name != "" {
+			exp, err := regexp.Compile(rule.Name)
+			if err != nil {
+				return uiRules{}, fmt.Errorf("invalid name expression in ui rule: %w", err)
+			}
+			c.name = exp
+		}
+		out.rules = append(out.rules, c)
+	}
+	return out, nil
+}
+
+// uiTraits are the parts of a field schema hints are inferred from.
+type uiTraits struct {
+	name        string
+	typ         string
+	format      string
+	description string
+	enum        bool
+	example     any
+	properties  []string
+	required    []string
+}
+
+// hints returns the ui:* keys for a field with the given traits.
+func (r uiRules) hints(t uiTraits) map[string]any {
+	out := make(map[string]any)
+	if t.enum {
+		out[uiWidget] = "select"
+	}
+	if r.helpThreshold > 0 && len(t.description) > r.helpThreshold {
+		out[uiHelp] = t.description
+	}
+	if s, ok := t.example.(string); ok && s != "" {
+		out[uiPlaceholder] = s
+	}
+	if t.typ == "object" && isSecretRef(t) {
+		out[uiField] = r.secretField
+	} else if t.typ == "object" && len(t.properties) > 1 {
+		out[uiOrder] = fieldOrder(t.properties, t.required)
+	}
+
+	for _, rule := range r.rules {
+		if rule.name != nil && !rule.name.MatchString(t.name) {
+			continue
+		}
+		if rule.Type != "" && rule.Type != t.typ {
+			continue
+		}
+		if rule.Format != "" && rule.Format != t.format {
+			continue
+		}
+		for k, v := range rule.Set {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// isSecretRef reports whether the field looks like a reference to a key in a kubernetes secret.
+func isSecretRef(t uiTraits) bool {
+	if secretRefName.MatchString(t.name) {
+		return true
+	}
+	has := make(map[string]bool, len(t.properties))
+	for _, p := range t.properties {
+		has[p] = true
+	}
+	return strings.Contains(strings.ToLower(t.name), "secret") && has["name"] && has["key"]
+}
+
+// fieldOrder puts required fields first, followed by the remaining fields in alphabetical order.
+func fieldOrder(properties, required []string) []string {
+	out := make([]string, 0, len(properties)+1)
+	seen := make(map[string]bool, len(properties))
+	for _, r := range required {
+		if !seen[r] {
+			out = append(out, r)
+			seen[r] = true
+		}
+	}
+	rest := make([]string, 0, len(properties))
+	for _, p := range properties {
+		if !seen[p] {
+			rest = append(rest, p)
+		}
+	}
+	sort.Strings(rest)
+	return append(append(out, rest...), "*")
+}
+
+// applyUIHints adds inferred ui:* keys to every field of the given schema. Keys already present are left alone.
+func (r uiRules) applyUIHints(name string, schema map[string]any) map[string]any {
+	out := make(map[string]any, len(schema))
+	for k, v := range schema {
+		out[k] = v
+	}
+
+	if props, ok := out["properties"].(map[string]any); ok {
+		converted := make(map[string]any, len(props))
+		for k, v := range props {
+			if p, ok := v.(map[string]any); ok {
+				converted[k] = r.applyUIHints(k, p)
+			} else {
+				converted[k] = v
+			}
+		}
+		out["properties"] = converted
+	}
+	if items, ok := out["items"].(map[string]any); ok {
+		out["items"] = r.applyUIHints(name, items)
+	}
+
+	t := uiTraits{name: name}
+	t.typ, _ = out["type"].(string)
+	t.format, _ = out["format"].(string)
+	t.description, _ = out["description"].(string)
+	_, t.enum = out["enum"]
+	t.example = out["example"]
+	if examples, ok := out["examples"].([]any); ok && len(examples) > 0 {
+		t.example = examples[0]
+	}
+	if props, ok := out["properties"].(map[string]any); ok {
+		t.properties = sortedKeys(props)
+	}
+	for _, req := range toSlice(out["required"]) {
+		if s, ok := req.(string); ok {
+			t.required = append(t.required, s)
+		}
+	}
+
+	for k, v := range r.hints(t) {
+		if _, ok := out[k]; ok {
+			continue
+		}
+		if k == uiHelp {
+			delete(out, "description")
+		}
+		if o, ok := v.([]string); ok {
+			v = ConvertSlice(o)
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// applyUIHintFields adds inferred ui:* hints to a terraform variable field and its nested fields.
+func (r uiRules) applyUIHintFields(name string, f *models.BackstageParamFields) {
+	if f == nil {
+		return
+	}
+	names := make([]string, 0, len(f.Properties))
+	for k, p := range f.Properties {
+		r.applyUIHintFields(k, p)
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	switch items := f.Items.(type) {
+	case *models.BackstageParamFields:
+		r.applyUIHintFields(name, items)
+	case []*models.BackstageParamFields:
+		for i := range items {
+			r.applyUIHintFields(name, items[i])
+		}
+	}
+	r.applyUIHintFields(name, f.AdditionalProperties)
+
+	t := uiTraits{
+		name:        name,
+		typ:         f.Type,
+		description: f.Description,
+		enum:        len(f.Enum) > 0,
+		properties:  names,
+		required:    f.Required,
+	}
+	for k, v := range r.hints(t) {
+		switch k {
+		case uiWidget:
+			if f.UIWidget == "" {
+				f.UIWidget = fmt.Sprint(v)
+			}
+		case uiField:
+			if f.UIField == "" {
+				f.UIField = fmt.Sprint(v)
+			}
+		case uiHelp:
+			if f.UIHelp == "" {
+				f.UIHelp = fmt.Sprint(v)
+				f.Description = ""
+			}
+		case uiPlaceholder:
+			if f.UIPlaceholder == "" {
+				f.UIPlaceholder = fmt.Sprint(v)
+			}
+		case uiOrder:
+			if f.UIOrder != nil {
+				continue
+			}
+			switch o := v.(type) {
+			case []string:
+				f.UIOrder = o
+			case []any: // lists read from the rules file
+				f.UIOrder = make([]string, 0, len(o))
+				for _, name := range o {
+					f.UIOrder = append(f.UIOrder, fmt.Sprint(name))
+				}
+			}
+		case uiOptions:
+			if o, ok := v.(map[string]any); ok && f.UIOptions == nil {
+				f.UIOptions = o
+			}
+		}
+	}
+}
@@ -7,12 +7,13 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/cnoe-io/cnoe-cli/pkg/models"
 	"github.com/itchyny/gojq"
 	yamlv3 "gopkg.in/yaml.v3"
 	"sigs.k8s.io/yaml"
 )
 
-type finder func(file os.DirEntry, currentDepth uint32, base string) ([]string, error)
+type finder func(ctx context.Context, file os.DirEntry, currentDepth uint32, base string) ([]string, error)
 
 type NotSupported struct {
 	Err error
@@ -27,6 +28,49 @@ type insertAtInput struct {
 	jqPathExpression string
 	fields           map[string]any
 	required         []string
+	// pages are added to the parameters list right after the one at jqPathExpression
+	pages []map[string]any
+	// steps replace the steps of the template when set
+	steps []any
+	// metadata is merged into the metadata of the template and owner replaces its owner when set
+	metadata map[string]any
+	owner    string
+	// insertions place fragments at their own paths instead of the defaults above
+	insertions []models.Insertion
+}
+
+// mapped returns true if the fragment is placed by an insertion.
+func (input insertAtInput) mapped(fragment string) bool {
+	for _, i := range input.insertions {
+		if i.Fragment == fragment {
+			return true
+		}
+	}
+	return false
+}
+
+// fragment returns the generated value of the fragment or false if there is none.
+func (input insertAtInput) fragment(name string) (any, bool) {
+	switch name {
+	case FragmentRequired:
+		if len(input.required) > 0 {
+			return input.required, true
+		}
+	case FragmentSteps:
+		if input.steps != nil {
+			return input.steps, true
+		}
+	case FragmentMetadata:
+		if len(input.metadata) > 0 {
+			return input.metadata, true
+		}
+	case FragmentOwner:
+		if input.owner != "" {
+			return input.owner, true
+		}
+	}
+	v, ok := input.fields[name]
+	return v, ok
 }
 
 type supportedFields struct {
@@ -53,8 +97,9 @@ func checkAndCreateDir(path string) error {
 	return nil
 }
 
-// return absolute path for given input, output, and template files, if output path does not exist, create it.
-func prepDirectories(inputDir, outputDir, templateFile string, oneOf bool) (string, string, string, error) {
+// return absolute path for given input, output, and template files, if output path does not exist and create is set,
+// create it.
+func prepDirectories(inputDir, outputDir, templateFile string, oneOf, create bool) (string, string, string, error) {
 	input, err := filepath.Abs(inputDir)
 	if err != nil {
 		return "", "", "", err
@@ -71,9 +116,11 @@ func prepDirectories(inputDir, outputDir, templateFile string, oneOf bool) (stri
 	if oneOf {
 		expectedOutput = filepath.Join(output, DefinitionsDir)
 	}
-	err = checkAndCreateDir(expectedOutput)
-	if err != nil {
-		return "", "", "", err
+	if create {
+		err = checkAndCreateDir(expectedOutput)
+		if err != nil {
+			return "", "", "", err
+		}
 	}
 
 	return input, expectedOutput, t, nil
@@ -81,13 +128,19 @@ func prepDirectories(inputDir, outputDir, templateFile string, oneOf bool) (stri
 
 // Use the given template file, add dependencies and enum fields at the object specified by insertionPoint.
 // Write the result to a file specified by outputFile.
-func writeCollapsedTemplate(ctx context.Context, input insertAtInput, outputFile string, resourceFiles []string) error {
-
+// writeCollapsedTemplate writes the template listing the resource files, with the overlays for all templates and the
+// ones named after the output file found next to the source applied.
+func writeCollapsedTemplate(ctx context.Context, w *outputWriter, c EntityConfig, input insertAtInput, outputFile, source string, resourceFiles []string) error {
 	t, err := oneOf(ctx, resourceFiles, input)
 	if err != nil {
 		return err
 	}
-	return writeOutput(t, outputFile)
+	out := EntityOutput{FileName: outputFile, Content: t, Source: source}
+	name := strings.TrimSuffix(filepath.Base(outputFile), ".yaml")
+	if err := applyNamedOverlays(ctx, c, &out, []string{OverlayAll, name}); err != nil {
+		return err
+	}
+	return w.write(out.Content, outputFile)
 }
 
 func oneOf(ctx context.Context, resourceFiles []string, input insertAtInput) (any, error) {
@@ -139,7 +192,13 @@ func insertAt(ctx context.Context, input insertAtInput) (any, error) {
 	if err != nil {
 		return nil, err
 	}
-	jqProp, err := jsonFromObject(input.fields)
+	fields := make(map[string]any, len(input.fields))
+	for k, v := range input.fields {
+		if !input.mapped(k) {
+			fields[k] = v
+		}
+	}
+	jqProp, err := jsonFromObject(fields)
 	if err != nil {
 		return nil, err
 	}
@@ -147,14 +206,63 @@ func insertAt(ctx context.Context, input insertAtInput) (any, error) {
 	var sb strings.Builder
 	// update the properties field. merge (*) then assign (=)
 	sb.WriteString(fmt.Sprintf("%s = %s * %s", input.jqPathExpression, input.jqPathExpression, string(jqProp)))
-	if len(input.required) > 0 {
+	if len(input.required) > 0 && !input.mapped(FragmentRequired) {
 		jqReq, err := jsonFromObject(input.required)
 		if err != nil {
 			return nil, err
 		}
 		// update the required field by feeding the new query the output from previous step (|)
 		sb.WriteString("| ")
-		sb.WriteString(fmt.Sprintf("%s.required = (%s.required + %s)", input.jqPathExpression, input.jqPathExpression, string(jqReq)))
+		// fields that are already required are not added again
+		sb.WriteString(fmt.Sprintf("%s.required = ((%s.required // []) + (%s - (%s.required // [])))",
+			input.jqPathExpression, input.jqPathExpression, string(jqReq), input.jqPathExpression))
+	}
+	if len(input.pages) > 0 {
+		jqPages, err := jsonFromObject(input.pages)
+		if err != nil {
+			return nil, err
+		}
+		// find the list the insertion point belongs to and add the pages right after it
+		sb.WriteString("| ")
+		sb.WriteString(fmt.Sprintf("path(%s) as $p | ", input.jqPathExpression))
+		sb.WriteString(`if ($p | length) == 0 or ($p[-1] | type) != "number" then error("insertAt must point to an element of a list to add pages") else . end | `)
+		sb.WriteString(fmt.Sprintf("setpath($p[:-1]; getpath($p[:-1])[:$p[-1]+1] + %s + getpath($p[:-1])[$p[-1]+1:])", string(jqPages)))
+	}
+	if input.steps != nil && !input.mapped(FragmentSteps) {
+		jqSteps, err := jsonFromObject(input.steps)
+		if err != nil {
+			return nil, err
+		}
+		sb.WriteString("| ")
+		sb.WriteString(fmt.Sprintf("%s = %s", stepsPath, string(jqSteps)))
+	}
+	if len(input.metadata) > 0 && !input.mapped(FragmentMetadata) {
+		jqMeta, err := jsonFromObject(input.metadata)
+		if err != nil {
+			return nil, err
+		}
+		sb.WriteString("| ")
+		sb.WriteString(fmt.Sprintf(".metadata = ((.metadata // {}) * %s)", string(jqMeta)))
+	}
+	if input.owner != "" && !input.mapped(FragmentOwner) {
+		jqOwner, err := jsonFromObject(input.owner)
+		if err != nil {
+			return nil, err
+		}
+		sb.WriteString("| ")
+		sb.WriteString(fmt.Sprintf(".spec.owner = %s", string(jqOwner)))
+	}
+	for _, i := range input.insertions {
+		v, ok := input.fragment(i.Fragment)
+		if !ok {
+			continue
+		}
+		expr, err := insertionExpression(i, v)
+		if err != nil {
+			return nil, err
+		}
+		sb.WriteString("| ")
+		sb.WriteString(expr)
 	}
 	query, err := gojq.Parse(sb.String())
 	if err != nil {
@@ -169,18 +277,14 @@ func insertAt(ctx context.Context, input insertAtInput) (any, error) {
 }
 
 func writeOutput(content any, path string) error {
-	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	data, err := encodeOutput(content)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-	enc := yamlv3.NewEncoder(f)
-	defer enc.Close()
-	enc.SetIndent(2)
-	return enc.Encode(content)
+	return os.WriteFile(path, data, 0644)
 }
 
-func getRelevantFiles(inputDir string, currentDepth uint32, f finder) ([]string, error) {
+func getRelevantFiles(ctx context.Context, inputDir string, currentDepth uint32, f finder) ([]string, error) {
 	base, err := filepath.Abs(inputDir)
 	if err != nil {
 		return nil, err
@@ -191,7 +295,7 @@ func getRelevantFiles(inputDir string, currentDepth uint32, f finder) ([]string,
 	}
 	out := make([]string, 0)
 	for _, file := range files {
-		o, err := f(file, currentDepth, base)
+		o, err := f(ctx, file, currentDepth, base)
 		if err != nil {
 			return nil, err
 		}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// entryResult is the result of handling a single definition.
+type entryResult struct {
+	outputs []EntityOutput
+	err     error
+}
+
+// handleEntries handles the definitions with up to c.Workers workers and returns the outputs in the order of the
+// definitions. Errors of all definitions are combined. With FailFast, no further definitions are handled after the
+// first error. Cancelling ctx stops handling definitions as well.
+func handleEntries(ctx context.Context, p Entity, definitions []string, outDir, templateFile string) ([][]EntityOutput, error) {
+	c := p.Config()
+	workers := c.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(definitions) {
+		workers = len(definitions)
+	}
+
+	entryCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make([]entryResult, len(definitions))
+	handled := make([]bool, len(definitions))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				outputs, err := p.HandleEntry(entryCtx, definitions[i], outDir, templateFile)
+				if err == nil {
+					err = applyOverlays(entryCtx, c, outputs)
+				}
+				results[i] = entryResult{outputs: outputs, err: err}
+				if err != nil && c.FailFast {
+					cancel()
+				}
+			}
+		}()
+	}
+
+	for i := range definitions {
+		if entryCtx.Err() != nil {
+			break
+		}
+		select {
+		case <-entryCtx.Done():
+		case jobs <- i:
+			handled[i] = true
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	var result *multierror.Error
+	outputs := make([][]EntityOutput, 0, len(definitions))
+	skipped := 0
+	for i, r := range results {
+		if !handled[i] {
+			skipped++
+			continue
+		}
+		if r.err != nil {
+			result = multierror.Append(result, fmt.Errorf("%s: %w", definitions[i], r.err))
+			continue
+		}
+		outputs = append(outputs, r.outputs)
+	}
+	if result != nil {
+		log.Printf("failed to process %d of %d definitions", len(result.Errors), len(definitions))
+	}
+	if skipped > 0 {
+		log.Printf("skipped %d of %d definitions", skipped, len(definitions))
+	}
+	if err := ctx.Err(); err != nil {
+		result = multierror.Append(result, err)
+	}
+	return outputs, result.ErrorOrNil()
+}
@@ -20,12 +20,12 @@ type Spec struct {
 type Config struct {
 	ApiVersion string   `yaml:"apiVersion"`
 	Kind       string   `yaml:"kind"`
-	Metadata   Metadata `yaml:"metadata",required`
+	Metadata   Metadata `yaml:"metadata"`
 	Spec       Spec     `yaml:"spec"`
 }
 
 type Metadata struct {
-	Name        string            `yaml:"name",required`
+	Name        string            `yaml:"name"`
 	Labels      map[string]string `yaml:"labels"`
 	Annotations map[string]string `yaml:"annotations"`
 }
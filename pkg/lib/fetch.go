@@ -0,0 +1,477 @@
+package lib
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"golang.org/x/mod/semver"
+)
+
+const (
+	registryDiscoveryPath = "/.well-known/terraform.json"
+	registryModulesKey    = "modules.v1"
+	registryDownloadKey   = "X-Terraform-Get"
+)
+
+var commitRef = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+
+//go:generate go run github.com/maxbrunsfeld/counterfeiter/v6 . IModuleFetcher
+type IModuleFetcher interface {
+	// Fetch makes the module available locally and returns the directory it is in.
+	Fetch(ctx context.Context, source ModuleSource) (string, error)
+}
+
+type moduleFetcher struct {
+	cacheDir string
+	offline  bool
+	client   *http.Client
+}
+
+// NewModuleFetcher returns a fetcher storing remote modules in cacheDir. Modules already in the cache are not fetched
+// again. When offline is set, the cache acts as a local stand-in for registries and repositories and nothing is
+// downloaded.
+func NewModuleFetcher(cacheDir string, offline bool) IModuleFetcher {
+	return moduleFetcher{
+		cacheDir: cacheDir,
+		offline:  offline,
+		client:   http.DefaultClient,
+	}
+}
+
+func (f moduleFetcher) Fetch(ctx context.Context, source ModuleSource) (string, error) {
+	if source.Type == SourceLocal {
+		dir, err := filepath.Abs(source.URL)
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(dir, source.Subdir), nil
+	}
+
+	if source.Type == SourceRegistry && source.Version == "" {
+		version, err := f.latestVersion(ctx, source)
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve the latest version of module %s: %w", source.Address, err)
+		}
+		source.Version = version
+	}
+
+	dir := filepath.Join(f.cacheDir, filepath.FromSlash(source.CacheKey()))
+	if _, err := os.Stat(dir); err == nil {
+		return filepath.Join(dir, source.Subdir), nil
+	}
+	if f.offline {
+		return "", fmt.Errorf("module %s is not in the cache at %s", source.Address, dir)
+	}
+
+	err := os.MkdirAll(filepath.Dir(dir), 0755)
+	if err != nil {
+		return "", err
+	}
+	// fetch into a temporary directory first so failed downloads do not end up in the cache
+	tmp, err := os.MkdirTemp(filepath.Dir(dir), ".fetch-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+
+	err = f.fetch(ctx, source, tmp)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch module %s: %w", source.Address, err)
+	}
+	err = os.Rename(tmp, dir)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, source.Subdir), nil
+}
+
+func (f moduleFetcher) fetch(ctx context.Context, source ModuleSource, dst string) error {
+	switch source.Type {
+	case SourceGit:
+		return f.fetchGit(ctx, source, dst)
+	case SourceArchive:
+		return f.fetchArchive(ctx, source.URL, dst)
+	case SourceRegistry:
+		return f.fetchRegistry(ctx, source, dst)
+	default:
+		return fmt.Errorf("unsupported source type %s", source.Type)
+	}
+}
+
+func (f moduleFetcher) fetchGit(ctx context.Context, source ModuleSource, dst string) error {
+	args := []string{"clone", "--quiet"}
+	checkout := commitRef.MatchString(source.Ref)
+	if source.Ref != "" && !checkout {
+		args = append(args, "--depth", "1", "--branch", source.Ref)
+	}
+	if source.Ref == "" {
+		args = append(args, "--depth", "1")
+	}
+	err := runGit(ctx, append(args, "--", source.URL, dst)...)
+	if err != nil {
+		return err
+	}
+	if checkout {
+		return runGit(ctx, "-C", dst, "checkout", "--quiet", source.Ref)
+	}
+	return nil
+}
+
+// runGit runs a git command. Transports running arbitrary commands, like ext::, are disabled since the urls may come
+// from a registry.
+func runGit(ctx context.Context, args ...string) error {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-c", "protocol.ext.allow=never"}, args...)...)
+	cmd.Env = append(os.Environ(), "GIT_ALLOW_PROTOCOL=https:ssh:git:http")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func (f moduleFetcher) fetchArchive(ctx context.Context, location, dst string) error {
+	u, err := url.Parse(location)
+	if err != nil {
+		return err
+	}
+	format := u.Query().Get("archive")
+	if format == "" {
+		format = u.Path
+	}
+
+	var src string
+	if u.Scheme == "http" || u.Scheme == "https" {
+		tmp, err := os.CreateTemp("", "module-*")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+		err = f.download(ctx, location, tmp)
+		if err != nil {
+			return err
+		}
+		src = tmp.Name()
+	} else {
+		src = location
+	}
+
+	switch {
+	case strings.HasSuffix(format, "zip"):
+		return extractZip(src, dst)
+	case strings.HasSuffix(format, "tar.gz"), strings.HasSuffix(format, "tgz"):
+		return extractTarGz(src, dst)
+	default:
+		return fmt.Errorf("unsupported archive format %s", format)
+	}
+}
+
+func (f moduleFetcher) download(ctx context.Context, location string, w io.Writer) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("downloading %s returned %s", location, resp.Status)
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// fetchRegistry implements the module registry protocol: the download endpoint returns the actual source of the
+// module version, which is then fetched.
+func (f moduleFetcher) fetchRegistry(ctx context.Context, source ModuleSource, dst string) error {
+	base, err := f.discoverModules(ctx, source.Host)
+	if err != nil {
+		return err
+	}
+	p := fmt.Sprintf("%s/%s/%s", source.Namespace, source.Name, source.Provider)
+	if source.Version != "" {
+		p = fmt.Sprintf("%s/%s", p, source.Version)
+	}
+	download, err := base.Parse(fmt.Sprintf("%s/download", p))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, download.String(), nil)
+	if err != nil {
+		return err
+	}
+	if token := registryToken(source.Host); token != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("registry %s returned %s for %s", source.Host, resp.Status, p)
+	}
+	location := resp.Header.Get(registryDownloadKey)
+	if location == "" {
+		return fmt.Errorf("registry %s did not return a download location for %s", source.Host, p)
+	}
+	// the location may be relative to the download endpoint
+	if strings.HasPrefix(location, "/") || strings.HasPrefix(location, "./") || strings.HasPrefix(location, "../") {
+		u, err := resp.Request.URL.Parse(location)
+		if err != nil {
+			return err
+		}
+		location = u.String()
+	}
+
+	actual, err := ParseModuleSource(location)
+	if err != nil {
+		return err
+	}
+	if actual.Type == SourceRegistry || actual.Type == SourceLocal {
+		return fmt.Errorf("registry %s returned an unsupported location %s", source.Host, location)
+	}
+	err = f.fetch(ctx, actual, dst)
+	if err != nil {
+		return err
+	}
+	if actual.Subdir != "" {
+		return hoist(filepath.Join(dst, actual.Subdir), dst)
+	}
+	return nil
+}
+
+// latestVersion returns the latest version of a registry module. When offline, it is the latest version in the cache.
+func (f moduleFetcher) latestVersion(ctx context.Context, source ModuleSource) (string, error) {
+	versions := make([]string, 0)
+	if f.offline {
+		dir := filepath.Join(f.cacheDir, filepath.FromSlash(source.registryKey()))
+		entries, err := os.ReadDir(dir)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+		for _, e := range entries {
+			if e.IsDir() {
+				versions = append(versions, e.Name())
+			}
+		}
+	} else {
+		base, err := f.discoverModules(ctx, source.Host)
+		if err != nil {
+			return "", err
+		}
+		list, err := base.Parse(fmt.Sprintf("%s/%s/%s/versions", source.Namespace, source.Name, source.Provider))
+		if err != nil {
+			return "", err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, list.String(), nil)
+		if err != nil {
+			return "", err
+		}
+		if token := registryToken(source.Host); token != "" {
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		}
+		resp, err := f.client.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("registry %s returned %s for the versions of %s", source.Host, resp.Status, source.Address)
+		}
+		var body struct {
+			Modules []struct {
+				Versions []struct {
+					Version string `json:"version"`
+				} `json:"versions"`
+			} `json:"modules"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&body)
+		if err != nil {
+			return "", err
+		}
+		for _, m := range body.Modules {
+			for _, v := range m.Versions {
+				versions = append(versions, v.Version)
+			}
+		}
+	}
+
+	latest := ""
+	for _, v := range versions {
+		// pre-releases are only used when asked for explicitly, like terraform does
+		if !semver.IsValid("v"+v) || semver.Prerelease("v"+v) != "" {
+			continue
+		}
+		if latest == "" || semver.Compare("v"+v, "v"+latest) > 0 {
+			latest = v
+		}
+	}
+	if latest == "" {
+		if f.offline {
+			return "", fmt.Errorf("no version of module %s is in the cache at %s", source.Address, f.cacheDir)
+		}
+		return "", fmt.Errorf("registry %s has no released version of %s", source.Host, source.Address)
+	}
+	return latest, nil
+}
+
+func (f moduleFetcher) discoverModules(ctx context.Context, host string) (*url.URL, error) {
+	base := &url.URL{Scheme: "https", Host: host}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base.JoinPath(registryDiscoveryPath).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("service discovery for %s returned %s", host, resp.Status)
+	}
+	var services map[string]any
+	err = json.NewDecoder(resp.Body).Decode(&services)
+	if err != nil {
+		return nil, err
+	}
+	modules, ok := services[registryModulesKey].(string)
+	if !ok {
+		return nil, fmt.Errorf("%s does not provide a module registry", host)
+	}
+	if !strings.HasSuffix(modules, "/") {
+		modules += "/"
+	}
+	return resp.Request.URL.Parse(modules)
+}
+
+// registryToken returns the token for the given host the same way terraform does, e.g. TF_TOKEN_app_terraform_io.
+func registryToken(host string) string {
+	name := strings.NewReplacer(".", "_", "-", "__").Replace(host)
+	return os.Getenv(fmt.Sprintf("TF_TOKEN_%s", name))
+}
+
+// hoist moves the contents of dir to dst and removes everything else in dst.
+func hoist(dir, dst string) error {
+	tmp, err := os.MkdirTemp(filepath.Dir(dst), ".hoist-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	sub := filepath.Join(tmp, "module")
+	err = os.Rename(dir, sub)
+	if err != nil {
+		return err
+	}
+	err = os.RemoveAll(dst)
+	if err != nil {
+		return err
+	}
+	return os.Rename(sub, dst)
+}
+
+func extractZip(src, dst string) error {
+	r, err := zip.OpenReader(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	for _, file := range r.File {
+		target, err := archiveTarget(dst, file.Name)
+		if err != nil {
+			return err
+		}
+		if file.FileInfo().IsDir() {
+			err = os.MkdirAll(target, 0755)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return err
+		}
+		err = writeFile(target, rc, file.Mode())
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func extractTarGz(src, dst string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		target, err := archiveTarget(dst, header.Name)
+		if err != nil {
+			return err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, 0755)
+		case tar.TypeReg:
+			err = writeFile(target, tr, header.FileInfo().Mode())
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// archiveTarget returns where an archive entry is extracted to, rejecting entries outside of dst.
+func archiveTarget(dst, name string) (string, error) {
+	target := filepath.Join(dst, filepath.FromSlash(name))
+	if target != dst && !strings.HasPrefix(target, filepath.Clean(dst)+string(os.PathSeparator)) {
+		return "", fmt.Errorf("archive entry %s is outside of the target directory", name)
+	}
+	return target, nil
+}
+
+func writeFile(path string, r io.Reader, mode os.FileMode) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode.Perm()|0600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	_, err = io.Copy(out, r)
+	return err
+}
@@ -7,6 +7,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/dynamic"
@@ -18,11 +19,32 @@ import (
 type IK8sClient interface {
 	Pods(namespace string) (*corev1.PodList, error)
 	CRDs(group, kind, version string) (*unstructured.UnstructuredList, error)
+	Definitions(ctx context.Context, selector DefinitionSelector) ([]unstructured.Unstructured, error)
+}
+
+var (
+	CRDResource = schema.GroupVersionResource{
+		Group:    "apiextensions.k8s.io",
+		Version:  "v1",
+		Resource: "customresourcedefinitions",
+	}
+	XRDResource = schema.GroupVersionResource{
+		Group:    "apiextensions.crossplane.io",
+		Version:  "v1",
+		Resource: "compositeresourcedefinitions",
+	}
+)
+
+// DefinitionSelector filters the CRDs and XRDs read from a cluster. Empty fields match every definition.
+type DefinitionSelector struct {
+	Groups        []string
+	LabelSelector string
+	Categories    []string
 }
 
 type k8sClient struct {
-	clientset     *kubernetes.Clientset
-	dynamicclient *dynamic.DynamicClient
+	clientset     kubernetes.Interface
+	dynamicclient dynamic.Interface
 }
 
 func NewK8sClient(kubeconfig string) (IK8sClient, error) {
@@ -49,6 +71,14 @@ func NewK8sClient(kubeconfig string) (IK8sClient, error) {
 	}, nil
 }
 
+// NewK8sClientForClients returns a client using the given clients, e.g. fakes in tests.
+func NewK8sClientForClients(clientset kubernetes.Interface, dynamicclient dynamic.Interface) IK8sClient {
+	return k8sClient{
+		clientset:     clientset,
+		dynamicclient: dynamicclient,
+	}
+}
+
 func (k k8sClient) Pods(namespace string) (*corev1.PodList, error) {
 	pods, err := k.clientset.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{})
 	if err != nil {
@@ -71,3 +101,64 @@ func (k k8sClient) CRDs(group, kind, version string) (*unstructured.Unstructured
 	}
 	return crdList, nil
 }
+
+// Definitions returns the CRDs and XRDs in the cluster matching the selector. XRDs are skipped in clusters without
+// Crossplane, and so are the CRDs Crossplane generates for their composite resources and claims.
+func (k k8sClient) Definitions(ctx context.Context, selector DefinitionSelector) ([]unstructured.Unstructured, error) {
+	out := make([]unstructured.Unstructured, 0)
+	for _, gvr := range []schema.GroupVersionResource{CRDResource, XRDResource} {
+		list, err := k.dynamicclient.Resource(gvr).List(ctx, metav1.ListOptions{
+			LabelSelector: selector.LabelSelector,
+		})
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range list.Items {
+			if selector.matches(item) && !generatedForXRD(item) {
+				out = append(out, item)
+			}
+		}
+	}
+	return out, nil
+}
+
+// generatedForXRD reports whether the definition is a CRD owned by an XRD, which already describes its schema.
+func generatedForXRD(def unstructured.Unstructured) bool {
+	for _, o := range def.GetOwnerReferences() {
+		if o.Kind == "CompositeResourceDefinition" && strings.HasPrefix(o.APIVersion, XRDResource.Group+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (s DefinitionSelector) matches(def unstructured.Unstructured) bool {
+	if len(s.Groups) > 0 {
+		group, _, _ := unstructured.NestedString(def.Object, "spec", "group")
+		if !containsString(s.Groups, group) {
+			return false
+		}
+	}
+	if len(s.Categories) > 0 {
+		categories, _, _ := unstructured.NestedStringSlice(def.Object, "spec", "names", "categories")
+		for _, c := range categories {
+			if containsString(s.Categories, c) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -2,6 +2,7 @@
 package libfakes
 
 import (
+	"context"
 	"sync"
 
 	"github.com/cnoe-io/cnoe-cli/pkg/lib"
@@ -25,6 +26,20 @@ type FakeIK8sClient struct {
 		result1 *unstructured.UnstructuredList
 		result2 error
 	}
+	DefinitionsStub        func(context.Context, lib.DefinitionSelector) ([]unstructured.Unstructured, error)
+	definitionsMutex       sync.RWMutex
+	definitionsArgsForCall []struct {
+		arg1 context.Context
+		arg2 lib.DefinitionSelector
+	}
+	definitionsReturns struct {
+		result1 []unstructured.Unstructured
+		result2 error
+	}
+	definitionsReturnsOnCall map[int]struct {
+		result1 []unstructured.Unstructured
+		result2 error
+	}
 	PodsStub        func(string) (*v1.PodList, error)
 	podsMutex       sync.RWMutex
 	podsArgsForCall []struct {
@@ -108,6 +123,71 @@ func (fake *FakeIK8sClient) CRDsReturnsOnCall(i int, result1 *unstructured.Unstr
 	}{result1, result2}
 }
 
+func (fake *FakeIK8sClient) Definitions(arg1 context.Context, arg2 lib.DefinitionSelector) ([]unstructured.Unstructured, error) {
+	fake.definitionsMutex.Lock()
+	ret, specificReturn := fake.definitionsReturnsOnCall[len(fake.definitionsArgsForCall)]
+	fake.definitionsArgsForCall = append(fake.definitionsArgsForCall, struct {
+		arg1 context.Context
+		arg2 lib.DefinitionSelector
+	}{arg1, arg2})
+	stub := fake.DefinitionsStub
+	fakeReturns := fake.definitionsReturns
+	fake.recordInvocation("Definitions", []interface{}{arg1, arg2})
+	fake.definitionsMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeIK8sClient) DefinitionsCallCount() int {
+	fake.definitionsMutex.RLock()
+	defer fake.definitionsMutex.RUnlock()
+	return len(fake.definitionsArgsForCall)
+}
+
+func (fake *FakeIK8sClient) DefinitionsCalls(stub func(context.Context, lib.DefinitionSelector) ([]unstructured.Unstructured, error)) {
+	fake.definitionsMutex.Lock()
+	defer fake.definitionsMutex.Unlock()
+	fake.DefinitionsStub = stub
+}
+
+func (fake *FakeIK8sClient) DefinitionsArgsForCall(i int) (context.Context, lib.DefinitionSelector) {
+	fake.definitionsMutex.RLock()
+	defer fake.definitionsMutex.RUnlock()
+	argsForCall := fake.definitionsArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeIK8sClient) DefinitionsReturns(result1 []unstructured.Unstructured, result2 error) {
+	fake.definitionsMutex.Lock()
+	defer fake.definitionsMutex.Unlock()
+	fake.DefinitionsStub = nil
+	fake.definitionsReturns = struct {
+		result1 []unstructured.Unstructured
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeIK8sClient) DefinitionsReturnsOnCall(i int, result1 []unstructured.Unstructured, result2 error) {
+	fake.definitionsMutex.Lock()
+	defer fake.definitionsMutex.Unlock()
+	fake.DefinitionsStub = nil
+	if fake.definitionsReturnsOnCall == nil {
+		fake.definitionsReturnsOnCall = make(map[int]struct {
+			result1 []unstructured.Unstructured
+			result2 error
+		})
+	}
+	fake.definitionsReturnsOnCall[i] = struct {
+		result1 []unstructured.Unstructured
+		result2 error
+	}{result1, result2}
+}
+
 func (fake *FakeIK8sClient) Pods(arg1 string) (*v1.PodList, error) {
 	fake.podsMutex.Lock()
 	ret, specificReturn := fake.podsReturnsOnCall[len(fake.podsArgsForCall)]
@@ -177,6 +257,8 @@ func (fake *FakeIK8sClient) Invocations() map[string][][]interface{} {
 	defer fake.invocationsMutex.RUnlock()
 	fake.cRDsMutex.RLock()
 	defer fake.cRDsMutex.RUnlock()
+	fake.definitionsMutex.RLock()
+	defer fake.definitionsMutex.RUnlock()
 	fake.podsMutex.RLock()
 	defer fake.podsMutex.RUnlock()
 	copiedInvocations := map[string][][]interface{}{}
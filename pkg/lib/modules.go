@@ -0,0 +1,207 @@
+package lib
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+type SourceType string
+
+const (
+	SourceLocal    SourceType = "local"
+	SourceRegistry SourceType = "registry"
+	SourceGit      SourceType = "git"
+	SourceArchive  SourceType = "archive"
+
+	DefaultRegistryHost = "registry.terraform.io"
+)
+
+var (
+	// [<host>/]<namespace>/<name>/<provider>[@<version>]
+	registrySource = regexp.MustCompile(`^(?:([a-zA-Z0-9.-]+\.[a-zA-Z]{2,}(?::\d+)?)/)?([a-zA-Z0-9][a-zA-Z0-9_-]*)/([a-zA-Z0-9][a-zA-Z0-9_-]*)/([a-z0-9]+)(?:@([^/@]+))?$`)
+	gitHosts       = []string{"github.com/", "gitlab.com/", "bitbucket.org/"}
+	archiveSuffix  = []string{".zip", ".tar.gz", ".tgz"}
+)
+
+// ModuleSource is a parsed Terraform module source address.
+type ModuleSource struct {
+	// Address is the address as given by the user.
+	Address string
+	Type    SourceType
+	// URL is the location of git repositories, archives and local modules.
+	URL string
+	// Ref is the git reference to check out.
+	Ref string
+	// Subdir is the directory within the fetched source the module is in.
+	Subdir string
+
+	// Registry modules only
+	Host      string
+	Namespace string
+	Name      string
+	Provider  string
+	Version   string
+}
+
+// ParseModuleSource parses module source addresses in the formats Terraform supports: local paths, registry addresses
+// (with an optional @version), git repositories with ?ref= and archives. A subdirectory can be selected with //.
+func ParseModuleSource(address string) (ModuleSource, error) {
+	s := ModuleSource{Address: address}
+	addr, subdir := splitSubdir(address)
+	s.Subdir = subdir
+
+	switch {
+	case strings.HasPrefix(addr, "git::"):
+		s.Type = SourceGit
+		s.URL = strings.TrimPrefix(addr, "git::")
+	case strings.HasPrefix(addr, "./"), strings.HasPrefix(addr, "../"), filepath.IsAbs(addr):
+		s.Type = SourceLocal
+		if isArchive(addr) {
+			s.Type = SourceArchive
+		}
+		s.URL = addr
+		return s, nil
+	case strings.HasPrefix(addr, "git@"):
+		s.Type = SourceGit
+		s.URL = addr
+	case hasAnyPrefix(addr, gitHosts):
+		s.Type = SourceGit
+		s.URL = fmt.Sprintf("https://%s", addr)
+	case strings.HasPrefix(addr, "http://"), strings.HasPrefix(addr, "https://"):
+		u, err := url.Parse(addr)
+		if err != nil {
+			return ModuleSource{}, fmt.Errorf("invalid module source %s: %w", address, err)
+		}
+		switch {
+		case strings.HasSuffix(u.Path, ".git"):
+			s.Type = SourceGit
+		case isArchive(u.Path), u.Query().Get("archive") != "":
+			s.Type = SourceArchive
+		default:
+			return ModuleSource{}, fmt.Errorf("unsupported module source %s. http sources must point to a git repository or an archive", address)
+		}
+		s.URL = addr
+	default:
+		// the version follows the subdirectory, e.g. ns/name/provider//modules/sub@1.0.0
+		if i := strings.LastIndex(s.Subdir, "@"); i >= 0 {
+			addr += s.Subdir[i:]
+			s.Subdir = s.Subdir[:i]
+		}
+		m := registrySource.FindStringSubmatch(addr)
+		if m == nil {
+			return ModuleSource{}, fmt.Errorf("unsupported module source %s", address)
+		}
+		s.Type = SourceRegistry
+		s.Host, s.Namespace, s.Name, s.Provider, s.Version = m[1], m[2], m[3], m[4], m[5]
+		if s.Host == "" {
+			s.Host = DefaultRegistryHost
+		}
+		return s, nil
+	}
+
+	if s.Type == SourceGit {
+		u, ref := splitQuery(s.URL, "ref")
+		s.URL, s.Ref = u, ref
+		// both end up on the git command line, where they must not be taken for options
+		if strings.HasPrefix(s.URL, "-") || strings.HasPrefix(s.Ref, "-") {
+			return ModuleSource{}, fmt.Errorf("invalid module source %s", address)
+		}
+	}
+	return s, nil
+}
+
+// ModuleName is a short name for the module, used for the generated files.
+func (s ModuleSource) ModuleName() string {
+	if s.Subdir != "" {
+		return path.Base(s.Subdir)
+	}
+	if s.Type == SourceRegistry {
+		return s.Name
+	}
+	u, _ := splitQuery(s.URL, "")
+	name := path.Base(strings.ReplaceAll(u, ":", "/"))
+	for _, suffix := range append(archiveSuffix, ".git") {
+		name = strings.TrimSuffix(name, suffix)
+	}
+	return name
+}
+
+// CacheKey is the directory fetched sources are stored in relative to the cache root. The version of registry
+// sources must be resolved first, so that newer releases are not hidden by a cached one.
+func (s ModuleSource) CacheKey() string {
+	if s.Type == SourceRegistry {
+		return path.Join(s.registryKey(), s.Version)
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s?ref=%s", s.URL, s.Ref)))
+	return path.Join(string(s.Type), fmt.Sprintf("%s-%s", s.ModuleName(), hex.EncodeToString(sum[:])[:12]))
+}
+
+// splitSubdir splits addresses such as git::https://example.com/modules.git//vpc?ref=v1 into the address without the
+// subdirectory and the subdirectory.
+func splitSubdir(address string) (string, string) {
+	start := 0
+	if i := strings.Index(address, "://"); i >= 0 {
+		start = i + len("://")
+	}
+	i := strings.Index(address[start:], "//")
+	if i < 0 {
+		return address, ""
+	}
+	i += start
+	subdir := address[i+2:]
+	query := ""
+	if q := strings.Index(subdir, "?"); q >= 0 {
+		subdir, query = subdir[:q], subdir[q:]
+	}
+	return address[:i] + query, subdir
+}
+
+// splitQuery removes the given parameter, or the whole query if key is empty, from the address and returns its value.
+func splitQuery(address, key string) (string, string) {
+	i := strings.Index(address, "?")
+	if i < 0 {
+		return address, ""
+	}
+	if key == "" {
+		return address[:i], ""
+	}
+	q, err := url.ParseQuery(address[i+1:])
+	if err != nil {
+		return address, ""
+	}
+	value := q.Get(key)
+	q.Del(key)
+	if len(q) == 0 {
+		return address[:i], value
+	}
+	return fmt.Sprintf("%s?%s", address[:i], q.Encode()), value
+}
+
+func isArchive(p string) bool {
+	for _, s := range archiveSuffix {
+		if strings.HasSuffix(p, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// registryKey is the cache directory holding the versions of a registry module.
+func (s ModuleSource) registryKey() string {
+	return path.Join("registry", s.Host, s.Namespace, s.Name, s.Provider)
+}
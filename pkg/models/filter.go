@@ -0,0 +1,16 @@
+package models
+
+// FieldFilters selects which fields of generated CRD forms are shown.
+type FieldFilters struct {
+	Filters []FieldFilter `json:"filters"`
+}
+
+// FieldFilter applies to definitions of the given group and kind. An empty kind or "*" matches every kind in the group.
+// Paths are relative to the resource spec and written as .field.nested or .list[*].field.
+type FieldFilter struct {
+	Group    string   `json:"group"`
+	Kind     string   `json:"kind,omitempty"`
+	Include  []string `json:"include,omitempty"`
+	Exclude  []string `json:"exclude,omitempty"`
+	MaxDepth int      `json:"maxDepth,omitempty"`
+}
@@ -0,0 +1,12 @@
+package models
+
+// Insertions maps the fragments generated for a template to the places they are inserted at.
+type Insertions struct {
+	Insertions []Insertion `json:"insertions"`
+}
+
+type Insertion struct {
+	Fragment string `json:"fragment"`
+	Path     string `json:"path"`
+	Merge    string `json:"merge,omitempty"`
+}
@@ -0,0 +1,12 @@
+package models
+
+// Pages groups generated properties into steps of the Backstage wizard.
+type Pages struct {
+	Pages []Page `json:"pages"`
+}
+
+type Page struct {
+	Title       string   `json:"title"`
+	Description string   `json:"description,omitempty"`
+	Properties  []string `json:"properties"`
+}
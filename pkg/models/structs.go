@@ -3,8 +3,9 @@ package models
 import "k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 
 type Metadata struct {
-	Name   string            `json:"name"`
-	Labels map[string]string `json:"labels,omitempty"`
+	Name        string            `json:"name"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
 }
 
 type Spec struct {
@@ -15,15 +16,22 @@ type Spec struct {
 	Names struct {
 		Kind string `json:"kind"`
 	} `json:"names"`
-	Versions []struct {
-		Name   string `json:"name"`
-		Schema struct {
-			OpenAPIV3Schema struct {
-				Properties map[string]interface{} `json:"properties"`
-			} `yaml:"openAPIV3Schema"`
-		} `json:"schema"`
-	} `json:"versions"`
-	Scope string
+	Versions []Version `json:"versions"`
+	Scope    string
+}
+
+type Version struct {
+	Name               string  `json:"name"`
+	Served             bool    `json:"served"`
+	Storage            bool    `json:"storage"`
+	Referenceable      bool    `json:"referenceable"` // XRD equivalent of storage
+	Deprecated         bool    `json:"deprecated,omitempty"`
+	DeprecationWarning *string `json:"deprecationWarning,omitempty"`
+	Schema             struct {
+		OpenAPIV3Schema struct {
+			Properties map[string]interface{} `json:"properties"`
+		} `yaml:"openAPIV3Schema"`
+	} `json:"schema"`
 }
 
 type Definition struct {
@@ -33,6 +41,19 @@ type Definition struct {
 	Spec       Spec     `json:"spec"`
 }
 
+// Composition is a Crossplane Composition implementing the composite resource referenced by CompositeTypeRef.
+type Composition struct {
+	Kind       string   `json:"kind"`
+	APIVersion string   `json:"apiVersion"`
+	Metadata   Metadata `json:"metadata"`
+	Spec       struct {
+		CompositeTypeRef struct {
+			APIVersion string `json:"apiVersion"`
+			Kind       string `json:"kind"`
+		} `json:"compositeTypeRef"`
+	} `json:"spec"`
+}
+
 type Resources struct {
 	Enum []string `json:"enum"`
 }
@@ -53,17 +74,34 @@ type Wrapper struct {
 }
 
 type BackstageParamFields struct {
-	Title                string `yaml:",omitempty"`
-	Type                 string
-	Description          string                           `yaml:",omitempty"`
-	Default              any                              `yaml:",omitempty"`
-	Items                *BackstageParamFields            `yaml:",omitempty"`
-	UIWidget             string                           `yaml:"ui:widget,omitempty"`
-	Properties           map[string]*BackstageParamFields `yaml:"UiWidget,omitempty"`
-	AdditionalProperties *AdditionalProperties            `yaml:"additionalProperties,omitempty"`
-	UniqueItems          *bool                            `yaml:",omitempty"` // This does not guarantee a set. Works for primitives only.
-}
-
-type AdditionalProperties struct { // technically any but for our case, it should be a type: string
-	Type string `yaml:",omitempty"`
+	Title       string `yaml:",omitempty"`
+	Type        string
+	Description string `yaml:",omitempty"`
+	Default     any    `yaml:",omitempty"`
+	// validation constraints
+	Enum             []any    `yaml:"enum,omitempty"`
+	Pattern          string   `yaml:"pattern,omitempty"`
+	MinLength        *int     `yaml:"minLength,omitempty"`
+	MaxLength        *int     `yaml:"maxLength,omitempty"`
+	Minimum          *float64 `yaml:"minimum,omitempty"`
+	Maximum          *float64 `yaml:"maximum,omitempty"`
+	ExclusiveMinimum *float64 `yaml:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum *float64 `yaml:"exclusiveMaximum,omitempty"`
+	// Items is a *BackstageParamFields for lists and sets, or a []*BackstageParamFields for tuples.
+	Items         any            `yaml:",omitempty"`
+	MinItems      *int           `yaml:"minItems,omitempty"`
+	MaxItems      *int           `yaml:"maxItems,omitempty"`
+	UIWidget      string         `yaml:"ui:widget,omitempty"`
+	UIField       string         `yaml:"ui:field,omitempty"`
+	UIHelp        string         `yaml:"ui:help,omitempty"`
+	UIPlaceholder string         `yaml:"ui:placeholder,omitempty"`
+	UIOrder       []string       `yaml:"ui:order,omitempty"`
+	UIOptions     map[string]any `yaml:"ui:options,omitempty"`
+	UIBackstage   map[string]any `yaml:"ui:backstage,omitempty"`
+	// Properties holds one field per attribute of an object.
+	Properties           map[string]*BackstageParamFields `yaml:"properties,omitempty"`
+	Required             []string                         `yaml:"required,omitempty"`
+	AdditionalProperties *BackstageParamFields            `yaml:"additionalProperties,omitempty"`
+	// UniqueItems does not guarantee a set. Works for primitives only.
+	UniqueItems *bool `yaml:"uniqueItems,omitempty"`
 }
@@ -0,0 +1,18 @@
+package models
+
+// UIRules configures how Backstage ui:* hints are inferred from a schema.
+type UIRules struct {
+	// HelpThreshold is the description length above which the description is shown as ui:help.
+	HelpThreshold int `json:"helpThreshold,omitempty"`
+	// SecretField is the ui:field used for fields that reference a secret.
+	SecretField string   `json:"secretField,omitempty"`
+	Rules       []UIRule `json:"rules,omitempty"`
+}
+
+// UIRule sets the given ui:* keys on every field matching all of the specified conditions.
+type UIRule struct {
+	Name   string         `json:"name,omitempty"` // regular expression matched against the field name
+	Type   string         `json:"type,omitempty"`
+	Format string         `json:"format,omitempty"`
+	Set    map[string]any `json:"set"`
+}